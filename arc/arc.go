@@ -0,0 +1,373 @@
+package arc
+
+import (
+	"container/list"
+	"gcache/lru"
+	"time"
+)
+
+// Cache Cache为ARC(Adaptive Replacement Cache)缓存，并发访问是不安全的。
+// t1 缓存只访问过一次的key，t2 缓存访问过多次的key，b1、b2 分别记录最近从t1、t2淘汰的key(只记录key和大小)。
+// 命中b1说明t1太小，命中b2说明t2太小，据此动态调整t1的目标容量p。容量按字节计算。
+type Cache struct {
+	//最大容量，0表示不限制
+	maxCap int
+	//t1 的目标容量
+	p int
+
+	t1, t2 arcList
+	b1, b2 arcList
+	//t1移动到t2的次数
+	promotions int64
+
+	// OnEvicted 可选，缓存项被移除时调用，t1、t2之间的移动不算移除
+	OnEvicted func(key string, value lru.Value, reason lru.EvictReason)
+}
+
+// arcList 一个lru链表，越靠前越近被访问
+type arcList struct {
+	//已经使用了的容量
+	usedMem int
+	ll      *list.List
+	mp      map[string]*list.Element
+}
+
+type entry struct {
+	key   string
+	value lru.Value
+	//过期时间，零值表示永不过期
+	expire time.Time
+	//key+value 所占的容量，b1、b2中value为nil，只保留size
+	size int
+}
+
+// expired 判断entry在now时刻是否已经过期
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+func newArcList() arcList {
+	return arcList{ll: list.New(), mp: map[string]*list.Element{}}
+}
+
+func (l *arcList) pushFront(kv *entry) {
+	l.mp[kv.key] = l.ll.PushFront(kv)
+	l.usedMem += kv.size
+}
+
+func (l *arcList) remove(ele *list.Element) *entry {
+	kv := ele.Value.(*entry)
+	l.ll.Remove(ele)
+	delete(l.mp, kv.key)
+	l.usedMem -= kv.size
+	return kv
+}
+
+// removeTail 删除最久没有访问的key
+func (l *arcList) removeTail() *entry {
+	if ele := l.ll.Back(); ele != nil {
+		return l.remove(ele)
+	}
+	return nil
+}
+
+// New 创造一个缓存。
+func New(maxCap int) *Cache {
+	return &Cache{
+		maxCap: maxCap,
+		t1:     newArcList(),
+		t2:     newArcList(),
+		b1:     newArcList(),
+		b2:     newArcList(),
+	}
+}
+
+// evicted 回调OnEvicted
+func (c *Cache) evicted(kv *entry, reason lru.EvictReason) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value, reason)
+	}
+}
+
+// Add 添加一个永不过期的值。
+func (c *Cache) Add(key string, value lru.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 添加一个值，expire为过期时间，零值表示永不过期。
+func (c *Cache) AddWithExpire(key string, value lru.Value, expire time.Time) {
+	kv := &entry{key: key, value: value, expire: expire, size: len(key) + value.Len()}
+
+	//已经在缓存中，更新值并移动到t2
+	for _, l := range []*arcList{&c.t1, &c.t2} {
+		if ele, ok := l.mp[key]; ok {
+			replaced := l.remove(ele)
+			c.t2.pushFront(kv)
+			if l == &c.t1 {
+				c.promotions++
+			}
+			c.evicted(replaced, lru.EvictReplaced)
+			c.replace(false)
+			return
+		}
+	}
+
+	//命中b1，说明t1太小，增大p
+	if ele, ok := c.b1.mp[key]; ok {
+		delta := kv.size
+		if c.b2.usedMem > c.b1.usedMem {
+			delta = c.b2.usedMem / c.b1.usedMem * kv.size
+		}
+		c.p = min(c.maxCap, c.p+delta)
+		c.b1.remove(ele)
+		c.t2.pushFront(kv)
+		c.replace(false)
+		return
+	}
+
+	//命中b2，说明t2太小，减小p
+	if ele, ok := c.b2.mp[key]; ok {
+		delta := kv.size
+		if c.b1.usedMem > c.b2.usedMem {
+			delta = c.b1.usedMem / c.b2.usedMem * kv.size
+		}
+		c.p = max(0, c.p-delta)
+		c.b2.remove(ele)
+		c.t2.pushFront(kv)
+		c.replace(true)
+		return
+	}
+
+	c.t1.pushFront(kv)
+	c.replace(false)
+}
+
+// evictFromT1 容量不足时，根据p判断应该从t1还是t2淘汰
+func (c *Cache) evictFromT1(hitB2 bool) bool {
+	return c.t1.ll.Len() > 0 && (c.t1.usedMem > c.p || (hitB2 && c.t1.usedMem == c.p) || c.t2.ll.Len() == 0)
+}
+
+// replace 容量不足时，根据p从t1或者t2淘汰key，并记录到对应的b1、b2
+func (c *Cache) replace(hitB2 bool) {
+	for c.overflow() {
+		c.evictOne(hitB2)
+	}
+	c.trimGhosts()
+}
+
+// overflow 判断是否超出容量
+func (c *Cache) overflow() bool {
+	return c.maxCap != 0 && c.t1.usedMem+c.t2.usedMem > c.maxCap
+}
+
+// evictOne 根据p从t1或者t2淘汰一个key，并记录到对应的b1、b2
+func (c *Cache) evictOne(hitB2 bool) {
+	var kv *entry
+	if c.evictFromT1(hitB2) {
+		kv = c.t1.removeTail()
+		c.b1.pushFront(&entry{key: kv.key, size: kv.size})
+	} else {
+		kv = c.t2.removeTail()
+		c.b2.pushFront(&entry{key: kv.key, size: kv.size})
+	}
+	c.evicted(kv, lru.EvictCapacity)
+}
+
+// trimGhosts 限制b1、b2的大小
+func (c *Cache) trimGhosts() {
+	if c.maxCap == 0 {
+		return
+	}
+	//b1、b2只记录最近淘汰的key：t1+b1 不超过maxCap，四个链表总共不超过2*maxCap
+	for c.b1.ll.Len() > 0 && c.t1.usedMem+c.b1.usedMem > c.maxCap {
+		c.b1.removeTail()
+	}
+	for c.b2.ll.Len() > 0 && c.t1.usedMem+c.t2.usedMem+c.b1.usedMem+c.b2.usedMem > 2*c.maxCap {
+		c.b2.removeTail()
+	}
+}
+
+// Victim 返回加入key之后最先被淘汰的key，key已经存在或者加入key不需要淘汰时ok为false。
+func (c *Cache) Victim(key string, value lru.Value) (victim string, ok bool) {
+	if _, ok := c.t1.mp[key]; ok {
+		return "", false
+	}
+	if _, ok := c.t2.mp[key]; ok {
+		return "", false
+	}
+	if c.maxCap == 0 || c.t1.usedMem+c.t2.usedMem+len(key)+value.Len() <= c.maxCap {
+		return "", false
+	}
+	_, hitB2 := c.b2.mp[key]
+	l := &c.t2
+	if c.evictFromT1(hitB2) {
+		l = &c.t1
+	}
+	if ele := l.ll.Back(); ele != nil {
+		return ele.Value.(*entry).key, true
+	}
+	return "", false
+}
+
+// Get 查找的key的值，命中后移动到t2头部，已过期的key会被删除并视为不存在。
+func (c *Cache) Get(key string) (value lru.Value, ok bool) {
+	for _, l := range []*arcList{&c.t1, &c.t2} {
+		if ele, ok := l.mp[key]; ok {
+			kv := ele.Value.(*entry)
+			if kv.expired(time.Now()) {
+				l.remove(ele)
+				c.evicted(kv, lru.EvictExpired)
+				return nil, false
+			}
+			l.remove(ele)
+			c.t2.pushFront(kv)
+			if l == &c.t1 {
+				c.promotions++
+			}
+			return kv.value, true
+		}
+	}
+	return nil, false
+}
+
+// Peek 查找key的值，不会移动到t2，也不会删除已过期的key，已过期的key视为不存在。
+func (c *Cache) Peek(key string) (value lru.Value, ok bool) {
+	for _, l := range []*arcList{&c.t1, &c.t2} {
+		if ele, ok := l.mp[key]; ok {
+			if kv := ele.Value.(*entry); !kv.expired(time.Now()) {
+				return kv.value, true
+			}
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// Delete 删除某key
+func (c *Cache) Delete(key string) bool {
+	for _, l := range []*arcList{&c.t1, &c.t2} {
+		if ele, ok := l.mp[key]; ok {
+			c.evicted(l.remove(ele), lru.EvictDeleted)
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveExpired 删除t1、t2中所有已过期的k-v，返回删除的个数。
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, l := range []*arcList{&c.t1, &c.t2} {
+		for ele := l.ll.Back(); ele != nil; {
+			prev := ele.Prev()
+			if kv := ele.Value.(*entry); kv.expired(now) {
+				l.remove(ele)
+				c.evicted(kv, lru.EvictExpired)
+				n++
+			}
+			ele = prev
+		}
+	}
+	return n
+}
+
+// Resize 修改容量，不会立即淘汰，超出的部分由Trim或者之后的Add淘汰。
+func (c *Cache) Resize(maxCap int) {
+	c.maxCap = maxCap
+	if c.maxCap != 0 {
+		c.p = min(c.p, c.maxCap)
+	}
+}
+
+// Trim 超出容量时最多淘汰n个k-v，返回是否已经不超出容量。
+func (c *Cache) Trim(n int) bool {
+	for ; n > 0 && c.overflow(); n-- {
+		c.evictOne(false)
+	}
+	c.trimGhosts()
+	return !c.overflow()
+}
+
+// Len 返回缓存k-v的个数，不包括b1、b2中只记录了key的项。
+func (c *Cache) Len() int {
+	return c.t1.ll.Len() + c.t2.ll.Len()
+}
+
+// Snapshot 返回t1、t2中所有未过期的缓存项，每个链表内按从最久没访问到最近访问的顺序。
+func (c *Cache) Snapshot() []lru.Entry {
+	now := time.Now()
+	entries := make([]lru.Entry, 0, c.Len())
+	for _, l := range []struct {
+		name string
+		l    *arcList
+	}{{"t1", &c.t1}, {"t2", &c.t2}} {
+		for ele := l.l.ll.Back(); ele != nil; ele = ele.Prev() {
+			if kv := ele.Value.(*entry); !kv.expired(now) {
+				entries = append(entries, lru.Entry{Key: kv.key, Value: kv.value, Expire: kv.expire, List: l.name})
+			}
+		}
+	}
+	return entries
+}
+
+// Restore 把快照中的缓存项加入到它原来所在链表(t1或t2)的头部
+func (c *Cache) Restore(e lru.Entry) {
+	for _, l := range []*arcList{&c.t1, &c.t2, &c.b1, &c.b2} {
+		if ele, ok := l.mp[e.Key]; ok {
+			l.remove(ele)
+		}
+	}
+	kv := &entry{key: e.Key, value: e.Value, expire: e.Expire, size: len(e.Key) + e.Value.Len()}
+	if e.List == "t2" {
+		c.t2.pushFront(kv)
+	} else {
+		c.t1.pushFront(kv)
+	}
+	c.replace(false)
+}
+
+// Stats 返回t1、t2的统计信息，以及b1、b2记录的key(不计入Bytes、Items)，晋升为t1移动到t2的次数。
+func (c *Cache) Stats() lru.Stats {
+	lists := make([]lru.ListStats, 0, 4)
+	for _, l := range []struct {
+		name string
+		l    *arcList
+	}{{"t1", &c.t1}, {"t2", &c.t2}, {"b1", &c.b1}, {"b2", &c.b2}} {
+		lists = append(lists, lru.ListStats{Name: l.name, Bytes: int64(l.l.usedMem), Items: int64(l.l.ll.Len())})
+	}
+	return lru.Stats{
+		Promotions: c.promotions,
+		Bytes:      int64(c.t1.usedMem + c.t2.usedMem),
+		Items:      int64(c.Len()),
+		Lists:      lists,
+	}
+}
+
+// Clear 清空缓存，保留容量设置。
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for _, l := range []*arcList{&c.t1, &c.t2} {
+			for ele := l.ll.Back(); ele != nil; ele = ele.Prev() {
+				c.evicted(ele.Value.(*entry), lru.EvictCleared)
+			}
+		}
+	}
+	c.p = 0
+	c.t1, c.t2 = newArcList(), newArcList()
+	c.b1, c.b2 = newArcList(), newArcList()
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
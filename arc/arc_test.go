@@ -0,0 +1,105 @@
+package arc
+
+import (
+	"fmt"
+	"gcache/lru"
+	"testing"
+	"time"
+)
+
+type myValue string
+
+func (v myValue) Len() int {
+	return len(v)
+}
+
+func TestCase1(t *testing.T) {
+	cache := New(40)
+	for i := 0; i < 4; i++ {
+		cache.Add(fmt.Sprintf("hell%d", i), myValue(fmt.Sprintf("worl%d", i)))
+	}
+	if cache.t1.ll.Len() != 4 || cache.t2.ll.Len() != 0 {
+		t.Error("只访问过一次的 kv 应该在 t1")
+	}
+	cache.Get("hell0")
+	cache.Get("hell1")
+	if cache.t1.ll.Len() != 2 || cache.t2.ll.Len() != 2 {
+		t.Error("访问过多次的 kv 应该在 t2")
+	}
+
+	//扫描一批新 key 只会淘汰 t1 中的 key
+	for i := 4; i < 10; i++ {
+		cache.Add(fmt.Sprintf("hell%d", i), myValue(fmt.Sprintf("worl%d", i)))
+	}
+	for _, key := range []string{"hell0", "hell1"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("%s 不应该被淘汰", key)
+		}
+	}
+	if cache.t1.usedMem+cache.t2.usedMem > 40 {
+		t.Error("超出容量")
+	}
+	if cache.b1.ll.Len() == 0 {
+		t.Error("从 t1 淘汰的 key 应该记录在 b1")
+	}
+}
+
+func TestCase2(t *testing.T) {
+	cache := New(40)
+	cache.Add("hell0", myValue("worl0"))
+	cache.Add("hell1", myValue("worl1"))
+	cache.Get("hell0")
+	cache.Get("hell1")
+	for i := 2; i < 5; i++ {
+		cache.Add(fmt.Sprintf("hell%d", i), myValue(fmt.Sprintf("worl%d", i)))
+	}
+	if _, ok := cache.b1.mp["hell2"]; !ok {
+		t.Fatal("hell2 应该记录在 b1")
+	}
+	//命中 b1，增大 t1 的目标容量，并直接加入 t2
+	cache.Add("hell2", myValue("worl2"))
+	if cache.p != 10 {
+		t.Errorf("p = %d, 预期 10", cache.p)
+	}
+	if _, ok := cache.t2.mp["hell2"]; !ok {
+		t.Error("命中 b1 的 key 应该加入 t2")
+	}
+	if cache.t1.usedMem+cache.t2.usedMem > 40 {
+		t.Error("超出容量")
+	}
+}
+
+func TestCase3(t *testing.T) {
+	got := map[string]lru.EvictReason{}
+	cache := New(30)
+	cache.OnEvicted = func(key string, value lru.Value, reason lru.EvictReason) {
+		got[key+"="+string(value.(myValue))] = reason
+	}
+	cache.AddWithExpire("hell0", myValue("worl0"), time.Now().Add(-time.Second))
+	cache.Add("hell1", myValue("worl1"))
+	cache.Add("hell1", myValue("WORL1"))
+	cache.Add("hell2", myValue("worl2"))
+	cache.Add("hell3", myValue("worl3"))
+	cache.Add("hell4", myValue("worl4"))
+	if _, ok := cache.Get("hell0"); ok {
+		t.Error("被淘汰的 kv 不应该能获取到")
+	}
+	cache.Delete("hell3")
+	cache.Clear()
+	want := map[string]lru.EvictReason{
+		"hell0=worl0": lru.EvictCapacity,
+		"hell1=worl1": lru.EvictReplaced,
+		"hell2=worl2": lru.EvictCapacity,
+		"hell3=worl3": lru.EvictDeleted,
+		"hell1=WORL1": lru.EvictCleared,
+		"hell4=worl4": lru.EvictCleared,
+	}
+	if len(got) != len(want) {
+		t.Errorf("OnEvicted 调用了 %d 次, 预期 %d 次: %v", len(got), len(want), got)
+	}
+	for k, reason := range want {
+		if got[k] != reason {
+			t.Errorf("%s 的移除原因为 %v, 预期 %v", k, got[k], reason)
+		}
+	}
+}
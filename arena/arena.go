@@ -0,0 +1,401 @@
+package arena
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	// headerSize 每个缓存项的头部：过期时间 int64(unix纳秒，0表示永不过期) | key长度 uint16 | value长度 uint32
+	headerSize = 8 + 2 + 4
+	// DefaultSize maxCap为0时arena的大小
+	DefaultSize = 64 << 20
+	// maxKeyLen key的最大长度
+	maxKeyLen = 1<<16 - 1
+)
+
+// Reason 缓存项被移除的原因，取值和lru.EvictReason一致
+type Reason int
+
+const (
+	// ReasonCapacity 空间不足被淘汰
+	ReasonCapacity Reason = iota
+	// ReasonExpired 已过期
+	ReasonExpired
+	// ReasonDeleted 被显式删除
+	ReasonDeleted
+	// ReasonReplaced 被同一个key的新值替换
+	ReasonReplaced
+	// ReasonCleared 缓存被清空
+	ReasonCleared
+)
+
+// Cache 把key和value存放在一块预先分配的环形字节数组(arena)里，索引为不含指针的map[uint64]uint32，
+// 缓存项再多GC也只需要扫描一个指针，适合缓存大量的小value。并发访问是不安全的。
+// 新的缓存项追加在尾部，空间不足时按FIFO从头部淘汰；更新和删除只修改索引，原来的字节等头部经过时再回收。
+type Cache struct {
+	buf []byte
+	//index key的哈希 -> 缓存项在buf中的偏移
+	index map[uint64]uint32
+	//head 最老的缓存项的偏移，tail 下一个缓存项写入的偏移
+	head, tail int
+	//wrapAt 数据绕回buf开头时，数据在[head, wrapAt)和[0, tail)两段，否则为-1，数据在[head, tail)
+	wrapAt int
+	//records buf中的缓存项个数，包括已经被更新或者删除的
+	records int
+	//usedMem 有效缓存项占用的字节数
+	usedMem int
+	//target Resize变小之后还没有完成的新大小，0表示没有
+	target int
+
+	// OnEvicted 可选，缓存项被移除时调用，value指向arena内部，只在回调期间有效
+	OnEvicted func(key string, value []byte, reason Reason)
+}
+
+// New 创建一个大小为maxCap字节的arena，maxCap为0时使用DefaultSize
+func New(maxCap int) *Cache {
+	if maxCap <= 0 {
+		maxCap = DefaultSize
+	}
+	return &Cache{
+		buf:    make([]byte, maxCap),
+		index:  map[uint64]uint32{},
+		wrapAt: -1,
+	}
+}
+
+// record 缓存项在buf中的视图
+type record struct {
+	offset int
+	expire int64
+	key    []byte
+	value  []byte
+}
+
+func (r *record) size() int {
+	return headerSize + len(r.key) + len(r.value)
+}
+
+func (r *record) expired(now int64) bool {
+	return r.expire != 0 && now > r.expire
+}
+
+// read 读取offset处的缓存项
+func (c *Cache) read(offset int) record {
+	b := c.buf[offset:]
+	keyLen := int(binary.LittleEndian.Uint16(b[8:]))
+	valLen := int(binary.LittleEndian.Uint32(b[10:]))
+	return record{
+		offset: offset,
+		expire: int64(binary.LittleEndian.Uint64(b)),
+		key:    b[headerSize : headerSize+keyLen],
+		value:  b[headerSize+keyLen : headerSize+keyLen+valLen],
+	}
+}
+
+// live 判断offset处的缓存项是否还有效，即没有被更新或者删除
+func (c *Cache) live(r *record) bool {
+	offset, ok := c.index[hash(r.key)]
+	return ok && int(offset) == r.offset
+}
+
+// lookup 查找key对应的缓存项
+func (c *Cache) lookup(key string) (record, bool) {
+	offset, ok := c.index[hash([]byte(key))]
+	if !ok {
+		return record{}, false
+	}
+	r := c.read(int(offset))
+	//哈希冲突
+	if string(r.key) != key {
+		return record{}, false
+	}
+	return r, true
+}
+
+// evicted 回调OnEvicted
+func (c *Cache) evicted(r *record, reason Reason) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(string(r.key), r.value, reason)
+	}
+}
+
+// unindex 把缓存项从索引中移除，它占用的字节等头部经过时再回收
+func (c *Cache) unindex(r *record) {
+	delete(c.index, hash(r.key))
+	c.usedMem -= r.size()
+}
+
+// capacity 返回arena的容量，正在缩容时为新的大小
+func (c *Cache) capacity() int {
+	if c.target > 0 {
+		return c.target
+	}
+	return len(c.buf)
+}
+
+// hasRoom 判断不淘汰的情况下能否写入need个字节，正在缩容时有效的缓存项不能超出新的大小
+func (c *Cache) hasRoom(need int) bool {
+	return c.fits(need) && (c.target == 0 || c.usedMem+need <= c.target)
+}
+
+// fits 判断不淘汰的情况下能否写入need个字节
+func (c *Cache) fits(need int) bool {
+	if c.records == 0 {
+		return need <= len(c.buf)
+	}
+	if c.wrapAt < 0 {
+		return len(c.buf)-c.tail >= need || c.head >= need
+	}
+	return c.head-c.tail >= need
+}
+
+// removeHead 回收头部最老的缓存项，有效的缓存项因为容量不足被淘汰
+func (c *Cache) removeHead() {
+	r := c.read(c.head)
+	if c.live(&r) {
+		c.unindex(&r)
+		c.evicted(&r, ReasonCapacity)
+	}
+	c.head += r.size()
+	c.records--
+	if c.head == c.wrapAt {
+		c.head, c.wrapAt = 0, -1
+	}
+	if c.records == 0 {
+		c.head, c.tail, c.wrapAt = 0, 0, -1
+	}
+}
+
+// headRecord 返回头部第一个有效的缓存项
+func (c *Cache) headRecord() (record, bool) {
+	found := record{}
+	ok := false
+	c.scan(func(r *record) bool {
+		found, ok = *r, true
+		return false
+	})
+	return found, ok
+}
+
+// scan 从最老到最新遍历有效的缓存项，fn返回false时停止
+func (c *Cache) scan(fn func(r *record) bool) {
+	if c.records == 0 {
+		return
+	}
+	offset, end := c.head, c.tail
+	if c.wrapAt >= 0 {
+		end = c.wrapAt
+	}
+	for {
+		for offset < end {
+			r := c.read(offset)
+			offset += r.size()
+			if c.live(&r) && !fn(&r) {
+				return
+			}
+		}
+		if end == c.tail {
+			return
+		}
+		offset, end = 0, c.tail
+	}
+}
+
+// Set 添加一个值，expire为零值表示永不过期。key太长或者缓存项比arena还大时不会写入，key原来的值也会被移除。
+func (c *Cache) Set(key string, value []byte, expire time.Time) {
+	//先移除旧值，新值写不进去时也不能继续返回旧值
+	if old, ok := c.lookup(key); ok {
+		c.unindex(&old)
+		c.evicted(&old, ReasonReplaced)
+	}
+	need := headerSize + len(key) + len(value)
+	if len(key) > maxKeyLen || need > c.capacity() {
+		return
+	}
+	if offset, ok := c.index[hash([]byte(key))]; ok {
+		//哈希冲突，覆盖另一个key
+		r := c.read(int(offset))
+		c.unindex(&r)
+		c.evicted(&r, ReasonCapacity)
+	}
+
+	for !c.hasRoom(need) {
+		c.removeHead()
+	}
+	if c.records > 0 && c.wrapAt < 0 && len(c.buf)-c.tail < need {
+		c.wrapAt, c.tail = c.tail, 0
+	}
+
+	b := c.buf[c.tail:]
+	var exp int64
+	if !expire.IsZero() {
+		exp = expire.UnixNano()
+	}
+	binary.LittleEndian.PutUint64(b, uint64(exp))
+	binary.LittleEndian.PutUint16(b[8:], uint16(len(key)))
+	binary.LittleEndian.PutUint32(b[10:], uint32(len(value)))
+	copy(b[headerSize:], key)
+	copy(b[headerSize+len(key):], value)
+
+	c.index[hash([]byte(key))] = uint32(c.tail)
+	c.tail += need
+	c.records++
+	c.usedMem += need
+}
+
+// Get 查找key的值，返回的value是拷贝。已过期的key会被删除并视为不存在。
+func (c *Cache) Get(key string) (value []byte, ok bool) {
+	r, ok := c.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	if r.expired(time.Now().UnixNano()) {
+		c.unindex(&r)
+		c.evicted(&r, ReasonExpired)
+		return nil, false
+	}
+	return append([]byte(nil), r.value...), true
+}
+
+// Peek 和Get一样返回value的拷贝，但不会删除已过期的key，已过期的key视为不存在。
+func (c *Cache) Peek(key string) (value []byte, ok bool) {
+	r, ok := c.lookup(key)
+	if !ok || r.expired(time.Now().UnixNano()) {
+		return nil, false
+	}
+	return append([]byte(nil), r.value...), true
+}
+
+// Victim 返回写入key之后最先被淘汰的key，key已经存在或者写入不需要淘汰时ok为false。
+func (c *Cache) Victim(key string, valueLen int) (victim string, ok bool) {
+	if _, ok := c.lookup(key); ok {
+		return "", false
+	}
+	if c.hasRoom(headerSize + len(key) + valueLen) {
+		return "", false
+	}
+	r, ok := c.headRecord()
+	if !ok {
+		return "", false
+	}
+	return string(r.key), true
+}
+
+// Delete 删除某key
+func (c *Cache) Delete(key string) bool {
+	r, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+	c.unindex(&r)
+	c.evicted(&r, ReasonDeleted)
+	return true
+}
+
+// RemoveExpired 删除所有已过期的缓存项，返回删除的个数
+func (c *Cache) RemoveExpired() int {
+	now := time.Now().UnixNano()
+	var expired []record
+	c.scan(func(r *record) bool {
+		if r.expired(now) {
+			expired = append(expired, *r)
+		}
+		return true
+	})
+	for i := range expired {
+		c.unindex(&expired[i])
+		c.evicted(&expired[i], ReasonExpired)
+	}
+	return len(expired)
+}
+
+// Range 从最老到最新遍历有效的缓存项，value指向arena内部，fn返回false时停止
+func (c *Cache) Range(fn func(key string, value []byte, expire time.Time) bool) {
+	c.scan(func(r *record) bool {
+		var expire time.Time
+		if r.expire != 0 {
+			expire = time.Unix(0, r.expire)
+		}
+		return fn(string(r.key), r.value, expire)
+	})
+}
+
+// Resize 修改arena的大小。变大时立即重新分配，拷贝所有有效的缓存项，耗时和缓存项的总大小成正比；
+// 变小时只记录新的大小，由Trim分批从头部淘汰放不下的缓存项，避免一次淘汰大量缓存项。
+func (c *Cache) Resize(maxCap int) {
+	if maxCap <= 0 {
+		maxCap = DefaultSize
+	}
+	if maxCap >= len(c.buf) {
+		c.rebuild(maxCap)
+		return
+	}
+	c.target = maxCap
+}
+
+// Trim 缩容时从头部最多淘汰n个缓存项，和Set空间不足时一样回调OnEvicted；
+// 有效的缓存项放得下新的大小之后重新分配arena，返回是否已经完成缩容。
+// 淘汰是分批的，但最后一次调用会一次拷贝所有剩下的缓存项，耗时和新的大小成正比，不受n限制。
+func (c *Cache) Trim(n int) bool {
+	if c.target == 0 {
+		return true
+	}
+	for ; n > 0 && c.usedMem > c.target; n-- {
+		c.removeHead()
+	}
+	if c.usedMem > c.target {
+		return false
+	}
+	//只拷贝不超过新大小的有效缓存项，不会再淘汰
+	c.rebuild(c.target)
+	return true
+}
+
+// rebuild 重新分配大小为maxCap的arena，并按从老到新的顺序把有效的缓存项写入，调用方保证它们放得下
+func (c *Cache) rebuild(maxCap int) {
+	old := *c
+	c.buf = make([]byte, maxCap)
+	c.index = map[uint64]uint32{}
+	c.head, c.tail, c.wrapAt, c.records, c.usedMem, c.target = 0, 0, -1, 0, 0, 0
+	old.scan(func(r *record) bool {
+		var expire time.Time
+		if r.expire != 0 {
+			expire = time.Unix(0, r.expire)
+		}
+		c.Set(string(r.key), r.value, expire)
+		return true
+	})
+}
+
+// Len 返回有效缓存项的个数
+func (c *Cache) Len() int {
+	return len(c.index)
+}
+
+// Bytes 返回有效缓存项占用的字节数，包括头部
+func (c *Cache) Bytes() int {
+	return c.usedMem
+}
+
+// Clear 清空缓存，保留arena
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		c.scan(func(r *record) bool {
+			c.evicted(r, ReasonCleared)
+			return true
+		})
+	}
+	c.index = map[uint64]uint32{}
+	c.head, c.tail, c.wrapAt, c.records, c.usedMem = 0, 0, -1, 0, 0
+}
+
+// hash FNV-1a 64
+func hash(key []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for _, b := range key {
+		h ^= uint64(b)
+		h *= 1099511628211
+	}
+	return h
+}
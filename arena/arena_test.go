@@ -0,0 +1,191 @@
+package arena
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSetGet(t *testing.T) {
+	c := New(1024)
+	c.Set("a", []byte("aa"), time.Time{})
+	c.Set("b", []byte("bb"), time.Time{})
+	if v, ok := c.Get("a"); !ok || string(v) != "aa" {
+		t.Fatal("获得的 a 不是预期的")
+	}
+	c.Set("a", []byte("aaa"), time.Time{})
+	if v, ok := c.Get("a"); !ok || string(v) != "aaa" {
+		t.Fatal("a 应该被更新")
+	}
+	if c.Len() != 2 || c.Bytes() != 2*headerSize+7 {
+		t.Errorf("Len = %d, Bytes = %d", c.Len(), c.Bytes())
+	}
+	if !c.Delete("b") || c.Delete("b") {
+		t.Error("Delete 结果不是预期的")
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Error("b 应该已经被删除")
+	}
+}
+
+func TestEvict(t *testing.T) {
+	//每个缓存项 headerSize+2+2 字节，能放下 3 个
+	size := headerSize + 4
+	c := New(3*size + size/2)
+	var evicted []string
+	c.OnEvicted = func(key string, value []byte, reason Reason) {
+		evicted = append(evicted, fmt.Sprintf("%s=%s:%d", key, value, reason))
+	}
+	for i := 0; i < 5; i++ {
+		c.Set(fmt.Sprintf("k%d", i), []byte(fmt.Sprintf("v%d", i)), time.Time{})
+	}
+	//写到结尾放不下时绕回开头，从头部按 FIFO 淘汰
+	want := []string{"k0=v0:0", "k1=v1:0"}
+	if fmt.Sprint(evicted) != fmt.Sprint(want) {
+		t.Errorf("evicted = %v, 预期 %v", evicted, want)
+	}
+	for i := 2; i < 5; i++ {
+		if v, ok := c.Get(fmt.Sprintf("k%d", i)); !ok || string(v) != fmt.Sprintf("v%d", i) {
+			t.Errorf("k%d 不应该被淘汰", i)
+		}
+	}
+	var keys []string
+	c.Range(func(key string, value []byte, expire time.Time) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if fmt.Sprint(keys) != "[k2 k3 k4]" {
+		t.Errorf("Range 的顺序不是从老到新: %v", keys)
+	}
+	if victim, ok := c.Victim("k5", 2); !ok || victim != "k2" {
+		t.Errorf("Victim = %s %v, 预期 k2", victim, ok)
+	}
+}
+
+func TestDeadSpace(t *testing.T) {
+	size := headerSize + 4
+	c := New(3 * size)
+	//反复更新同一个 key，旧的字节在头部经过时回收，不会淘汰其他 key
+	c.Set("k0", []byte("v0"), time.Time{})
+	for i := 0; i < 10; i++ {
+		c.Set("k1", []byte(fmt.Sprintf("v%d", i)), time.Time{})
+		c.Delete("k0")
+		c.Set("k0", []byte("v0"), time.Time{})
+	}
+	if c.Len() != 2 || c.Bytes() != 2*size {
+		t.Errorf("Len = %d, Bytes = %d", c.Len(), c.Bytes())
+	}
+	if v, ok := c.Get("k1"); !ok || string(v) != "v9" {
+		t.Error("k1 应该是最后写入的值")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	c := New(1024)
+	c.Set("a", []byte("aa"), time.Now().Add(50*time.Millisecond))
+	c.Set("b", []byte("bb"), time.Now().Add(50*time.Millisecond))
+	c.Set("c", []byte("cc"), time.Time{})
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Error("a 应该已经过期")
+	}
+	if n := c.RemoveExpired(); n != 1 || c.Len() != 1 {
+		t.Errorf("RemoveExpired = %d, Len = %d", n, c.Len())
+	}
+}
+
+func TestResize(t *testing.T) {
+	size := headerSize + 4
+	c := New(4 * size)
+	for i := 0; i < 4; i++ {
+		c.Set(fmt.Sprintf("k%d", i), []byte(fmt.Sprintf("v%d", i)), time.Time{})
+	}
+	var evicted []string
+	c.OnEvicted = func(key string, value []byte, reason Reason) {
+		evicted = append(evicted, fmt.Sprintf("%s=%s:%d", key, value, reason))
+	}
+	//缩容不会立即淘汰，由Trim分批淘汰
+	c.Resize(2 * size)
+	if c.Len() != 4 || len(evicted) != 0 {
+		t.Fatalf("Resize 不应该立即淘汰, Len = %d", c.Len())
+	}
+	//缩容期间写入按新的大小淘汰
+	if victim, ok := c.Victim("k4", 2); !ok || victim != "k0" {
+		t.Errorf("Victim = %s %v, 预期 k0", victim, ok)
+	}
+	if c.Trim(1) {
+		t.Error("还没有完成缩容")
+	}
+	if !c.Trim(1) || len(c.buf) != 2*size {
+		t.Errorf("应该完成缩容, len(buf) = %d", len(c.buf))
+	}
+	if c.Len() != 2 || c.Bytes() != 2*size {
+		t.Fatalf("Len = %d, Bytes = %d, 预期 2", c.Len(), c.Bytes())
+	}
+	//放不下的缓存项和空间不足时一样回调
+	if fmt.Sprint(evicted) != "[k0=v0:0 k1=v1:0]" {
+		t.Errorf("evicted = %v", evicted)
+	}
+	for _, key := range []string{"k2", "k3"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("最新的 %s 不应该被淘汰", key)
+		}
+	}
+}
+
+func TestResizeGrow(t *testing.T) {
+	size := headerSize + 4
+	c := New(2 * size)
+	c.Set("k0", []byte("v0"), time.Time{})
+	c.Set("k1", []byte("v1"), time.Time{})
+	c.Resize(4 * size)
+	c.Set("k2", []byte("v2"), time.Time{})
+	if c.Len() != 3 || !c.Trim(1) {
+		t.Errorf("扩容应该立即生效, Len = %d", c.Len())
+	}
+}
+
+func TestSetTooLarge(t *testing.T) {
+	c := New(64)
+	var evicted []string
+	c.OnEvicted = func(key string, value []byte, reason Reason) {
+		evicted = append(evicted, fmt.Sprintf("%s=%s:%d", key, value, reason))
+	}
+	c.Set("k", []byte("old"), time.Time{})
+	//新值比arena还大，旧值也要被移除
+	c.Set("k", make([]byte, 100), time.Time{})
+	if _, ok := c.Get("k"); ok || c.Len() != 0 || c.Bytes() != 0 {
+		t.Errorf("旧值不应该保留, Len = %d, Bytes = %d", c.Len(), c.Bytes())
+	}
+	if fmt.Sprint(evicted) != "[k=old:3]" {
+		t.Errorf("evicted = %v", evicted)
+	}
+}
+
+func TestClear(t *testing.T) {
+	c := New(1024)
+	n := 0
+	c.OnEvicted = func(key string, value []byte, reason Reason) {
+		if reason == ReasonCleared {
+			n++
+		}
+	}
+	c.Set("a", []byte("aa"), time.Time{})
+	c.Set("b", []byte("bb"), time.Time{})
+	c.Clear()
+	if n != 2 || c.Len() != 0 || c.Bytes() != 0 {
+		t.Errorf("n = %d, Len = %d", n, c.Len())
+	}
+	c.Set("c", []byte("cc"), time.Time{})
+	if _, ok := c.Get("c"); !ok {
+		t.Error("清空之后应该可以继续写入")
+	}
+}
+
+func BenchmarkSet(b *testing.B) {
+	c := New(1 << 20)
+	value := make([]byte, 64)
+	for i := 0; i < b.N; i++ {
+		c.Set(fmt.Sprintf("key%d", i), value, time.Time{})
+	}
+}
@@ -2,46 +2,211 @@ package gcache
 
 import (
 	"gcache/lru"
+	"gcache/tinylfu"
 	"sync"
+	"time"
 )
 
-// cache 把lru.Cache封装成并发安全 Concurrent security
+// resizeBatch 缩容时每次持有锁最多淘汰的缓存项个数
+const resizeBatch = 128
+
+// cache 把淘汰策略Policy封装成并发安全 Concurrent security
 type csCache struct {
-	mu     sync.Mutex
-	lru    *lru.Cache
-	maxCap int
+	mu        sync.Mutex
+	policy    Policy
+	maxCap    int
+	newPolicy PolicyFactory
+	//准入过滤器，nil表示不过滤
+	admission *tinylfu.Filter
+	//缓存项被移除时回调，在释放mu之后调用
+	onEvicted func(key string, value ByteView, reason lru.EvictReason)
+	//持有mu期间被移除的缓存项，等释放mu之后再回调onEvicted
+	evicted []evictedEntry
+	//因为容量不足、过期被移除的缓存项个数
+	evictions   atomicInt
+	expirations atomicInt
+}
+
+type evictedEntry struct {
+	key    string
+	value  ByteView
+	reason lru.EvictReason
 }
 
-func (c *csCache) add(key string, value ByteView) {
+// lazyInit 延时加载Policy，调用方需要持有mu
+func (c *csCache) lazyInit() {
+	if c.policy == nil {
+		c.policy = c.newPolicy(c.maxCap, c.onPolicyEvicted)
+	}
+}
+
+// onPolicyEvicted Policy移除缓存项时调用，此时持有mu
+func (c *csCache) onPolicyEvicted(key string, value lru.Value, reason lru.EvictReason) {
+	switch reason {
+	case lru.EvictCapacity:
+		c.evictions.Add(1)
+	case lru.EvictExpired:
+		c.expirations.Add(1)
+	}
+	if c.onEvicted != nil {
+		c.evicted = append(c.evicted, evictedEntry{key, value.(ByteView), reason})
+	}
+}
+
+// unlock 释放mu，然后回调持有mu期间被移除的缓存项
+func (c *csCache) unlock() {
+	evicted := c.evicted
+	c.evicted = nil
+	c.mu.Unlock()
+	for _, e := range evicted {
+		c.onEvicted(e.key, e.value, e.reason)
+	}
+}
+
+// add 添加一个值，expire为零值表示永不过期。加载的值在get没有命中时已经记录到准入过滤器，这里不再记录
+func (c *csCache) add(key string, value ByteView, expire time.Time) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
-		//延时加载lru.Cache
-		c.lru = lru.New(c.maxCap)
+	defer c.unlock()
+	c.lazyInit()
+	c.addLocked(key, value, expire)
+}
+
+// set 和add一样，但值来自Set：写入也是一次访问，否则只写不读的key频率一直为0，永远不能被准入
+func (c *csCache) set(key string, value ByteView, expire time.Time) {
+	c.mu.Lock()
+	defer c.unlock()
+	c.lazyInit()
+	if c.admission != nil {
+		c.admission.Record(key)
 	}
-	c.lru.Add(key, value)
+	c.addLocked(key, value, expire)
+}
+
+// addLocked 调用方需要持有mu
+func (c *csCache) addLocked(key string, value ByteView, expire time.Time) {
+	if c.admission != nil {
+		//新key需要淘汰其他key时，只有估算的访问频率比被淘汰的key高才能加入
+		if victim, ok := c.policy.Victim(key, value); ok && !c.admission.Admit(key, victim) {
+			return
+		}
+	}
+	c.policy.AddWithExpire(key, value, expire)
 }
 
 func (c *csCache) get(key string) (value ByteView, ok bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
+	defer c.unlock()
+	if c.admission != nil {
+		c.admission.Record(key)
+	}
+	if c.policy == nil {
 		return
 	}
 
-	if v, ok := c.lru.Get(key); ok {
+	if v, ok := c.policy.Get(key); ok {
 		return v.(ByteView), ok
 	}
 
 	return
 }
 
-func (c *csCache) delete(key string) bool {
+// peek 查找key的值，不更新访问记录，也不记录到准入过滤器
+func (c *csCache) peek(key string) (value ByteView, ok bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
+	if c.policy == nil {
+		return
+	}
+	if v, ok := c.policy.Peek(key); ok {
+		return v.(ByteView), ok
+	}
+	return
+}
+
+// len 返回缓存k-v的个数
+func (c *csCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy == nil {
+		return 0
+	}
+	return c.policy.Len()
+}
+
+func (c *csCache) delete(key string) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.policy == nil {
 		return false
 	}
-	ok := c.lru.Delete(key)
+	ok := c.policy.Delete(key)
 	return ok
 }
+
+// removeExpired 删除所有已过期的值，返回删除的个数
+func (c *csCache) removeExpired() int {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.policy == nil {
+		return 0
+	}
+	return c.policy.RemoveExpired()
+}
+
+// clear 清空缓存
+func (c *csCache) clear() {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.policy == nil {
+		return
+	}
+	c.policy.Clear()
+}
+
+// policyStats 返回Policy的统计信息
+func (c *csCache) policyStats() lru.Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy == nil {
+		return lru.Stats{}
+	}
+	return c.policy.Stats()
+}
+
+// snapshot 返回所有未过期的缓存项
+func (c *csCache) snapshot() []lru.Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy == nil {
+		return nil
+	}
+	return c.policy.Snapshot()
+}
+
+// restore 把快照中的缓存项加入缓存，不经过准入过滤
+func (c *csCache) restore(entries []lru.Entry) {
+	c.mu.Lock()
+	defer c.unlock()
+	c.lazyInit()
+	for _, e := range entries {
+		c.policy.Restore(e)
+	}
+}
+
+// resize 修改容量，然后每次持有锁淘汰最多resizeBatch个缓存项，直到不超出容量，避免缩容时长时间持有锁
+func (c *csCache) resize(maxCap int) {
+	c.mu.Lock()
+	c.maxCap = maxCap
+	if c.policy == nil {
+		c.mu.Unlock()
+		return
+	}
+	c.policy.Resize(maxCap)
+	c.unlock()
+
+	for done := false; !done; {
+		c.mu.Lock()
+		done = c.policy.Trim(resizeBatch)
+		c.unlock()
+	}
+}
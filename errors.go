@@ -0,0 +1,107 @@
+package gcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrNotFound key不存在。Getter返回的错误满足errors.Is(err, ErrNotFound)时，启用了负缓存的GCache会在NegativeTTL内记住这个key不存在
+	ErrNotFound = errors.New("gcache: key not found")
+	// ErrKeyRequired key为空
+	ErrKeyRequired = errors.New("gcache: key is required")
+	// ErrPeerUnavailable 远端peer连接失败、超时或者暂时不能提供服务
+	ErrPeerUnavailable = errors.New("gcache: peer unavailable")
+	// ErrOriginFailed Getter从数据源加载失败(不是ErrNotFound的其他错误)
+	ErrOriginFailed = errors.New("gcache: origin failed")
+)
+
+// Error Get返回的带分类的错误，errors.Is(err, Kind)为true，errors.Unwrap返回原始错误Err
+type Error struct {
+	//Kind 错误分类：ErrNotFound、ErrKeyRequired、ErrPeerUnavailable、ErrOriginFailed
+	Kind error
+	Key  string
+	//Err 原始错误，可能为nil
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%v (key %q)", e.Kind, e.Key)
+	}
+	return fmt.Sprintf("%v (key %q): %v", e.Kind, e.Key, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is 使errors.Is(err, e.Kind)为true
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// kindOf 返回err的分类，不属于任何分类时返回nil
+func kindOf(err error) error {
+	for _, kind := range []error{ErrNotFound, ErrKeyRequired, ErrPeerUnavailable, ErrOriginFailed} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return nil
+}
+
+// wrapError 把err包装成*Error，err已经有分类时保留原来的分类，否则使用kind
+func wrapError(kind error, key string, err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	if k := kindOf(err); k != nil {
+		kind = k
+	}
+	return &Error{Kind: kind, Key: key, Err: err}
+}
+
+// keyedError 和wrapError一样，但err是没有key的*Error(比如整个批量请求失败)时复制一份并填上key
+func keyedError(kind error, key string, err error) error {
+	var e *Error
+	if errors.As(err, &e) && e.Key == "" {
+		return &Error{Kind: e.Kind, Key: key, Err: e.Err}
+	}
+	return wrapError(kind, key, err)
+}
+
+// StatusCode 返回err对应的HTTP状态码，HTTPPool和对外的API服务可以用它返回错误
+func StatusCode(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return http.StatusGatewayTimeout
+	}
+	switch kindOf(err) {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrKeyRequired:
+		return http.StatusBadRequest
+	case ErrOriginFailed:
+		return http.StatusBadGateway
+	case ErrPeerUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// errorFromStatus 把远端peer返回的HTTP状态码还原为对应的分类，msg为响应的内容
+func errorFromStatus(code int, key string, msg string) error {
+	kind := ErrPeerUnavailable
+	switch code {
+	case http.StatusNotFound:
+		kind = ErrNotFound
+	case http.StatusBadRequest:
+		kind = ErrKeyRequired
+	case http.StatusBadGateway:
+		kind = ErrOriginFailed
+	}
+	return &Error{Kind: kind, Key: key, Err: fmt.Errorf("peer returned %d: %s", code, msg)}
+}
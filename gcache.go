@@ -1,20 +1,90 @@
 package gcache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"gcache/lru"
 	"gcache/singleflight"
 	"log"
+	"math/rand"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+)
+
+const (
+	// defaultSweepInterval 设置了DefaultTTL或NegativeTTL但没有设置SweepInterval时，后台清理过期缓存的间隔
+	defaultSweepInterval = time.Minute
+	// defaultNegativeRatio 没有设置NegativeCap时，负缓存的容量为maxCap/defaultNegativeRatio
+	defaultNegativeRatio = 8
+	// defaultHotTTL 没有设置HotTTL时，热点缓存中缓存项的过期时间
+	defaultHotTTL = time.Minute
+	// defaultHotRatio 没有设置HotRatio时，平均每从peer加载defaultHotRatio次缓存一次
+	defaultHotRatio = 10
 )
 
 // GCache  是一个缓存空间，加载的关联数据分布在上面
 type GCache struct {
+	//name NewGroup指定的名字
+	name string
 	//getter 当缓存找不到值的时候，就让用户决定去哪里找值
 	Getter    Getter
-	MainCache csCache
+	MainCache *shardedCache
 	Peers     PeerPicker
-	//确保不会发出多个一样的请求
-	Loader *singleflight.Ones
+	//确保不会发出多个一样的请求，调用方取消时只是不再等待，所有调用方都取消时才取消加载
+	Loader *singleflight.Group[string, ByteView]
+	//缓存项的默认过期时间，0表示永不过期
+	defaultTTL time.Duration
+	//负缓存，记录Getter返回ErrNotFound的key，nil表示不启用
+	negCache    *csCache
+	negativeTTL time.Duration
+	//没有设置NegativeCap，负缓存的容量随Resize按maxCap/defaultNegativeRatio调整
+	negativeRatio bool
+	//热点缓存，缓存一部分从peer加载的值，避免热点key的所有请求都发到同一个peer，nil表示不启用
+	hotCache *csCache
+	hotTTL   time.Duration
+	hotRatio int
+	//统计信息
+	stats cacheStats
+	//关闭后台清理过期缓存的goroutine
+	stopSweep chan struct{}
+	closeOnce sync.Once
+}
+
+// Options NewCacheWithOptions 的可选配置，零值表示使用默认配置。
+type Options struct {
+	//DefaultTTL 缓存项的默认过期时间，0表示永不过期
+	DefaultTTL time.Duration
+	//SweepInterval 后台清理过期缓存项的间隔。
+	//为0时，如果设置了DefaultTTL则使用defaultSweepInterval，否则不清理；为负数时不启动后台清理
+	SweepInterval time.Duration
+	//Policy 淘汰策略，nil表示按LRU配置的中点插入LRU
+	Policy PolicyFactory
+	//LRU old、young两个链表的容量比例和晋升规则，只在Policy为nil时生效
+	LRU lru.Options
+	//AdmissionCounters 大于0时启用W-TinyLFU准入过滤：新key需要淘汰其他key时，只有访问频率更高才会被缓存。
+	//值为count-min sketch每一行计数器的个数，建议设置为预计缓存key个数的数倍
+	AdmissionCounters int
+	//Shards 本地缓存的分片个数，每个分片有自己的锁，容量为maxCap/Shards。0表示不分片
+	Shards int
+	//NegativeTTL 大于0时启用负缓存：Getter返回ErrNotFound的key在NegativeTTL内直接返回ErrNotFound，不再调用Getter
+	NegativeTTL time.Duration
+	//NegativeCap 负缓存的容量，0表示maxCap/defaultNegativeRatio
+	NegativeCap int
+	//HotCap 大于0时启用热点缓存：从peer加载的值按HotRatio随机地缓存在本地，容量为HotCap，不影响MainCache
+	HotCap int
+	//HotTTL 热点缓存中缓存项的过期时间，所有者更新了值之后最多HotTTL内还会返回旧值，0表示defaultHotTTL
+	HotTTL time.Duration
+	//HotRatio 平均每从peer加载HotRatio次缓存一次，越热的key越可能被缓存，0表示defaultHotRatio，1表示每次都缓存
+	HotRatio int
+	//LoadReuseWindow 同一个key加载成功之后，结果继续返回给其他调用方的时间，0表示singleflight.DefaultSuccessWindow，负数表示不复用
+	LoadReuseWindow time.Duration
+	//LoadErrorReuseWindow 同一个key加载失败之后，错误继续返回给其他调用方的时间，0表示不复用
+	LoadErrorReuseWindow time.Duration
+	//OnEvicted 可选，缓存项被移除时调用，调用时不持有缓存的锁，可以在回调里做I/O
+	OnEvicted func(key string, value ByteView, reason lru.EvictReason)
 }
 
 // Getter 当缓存找不到值的时候，就让用户决定去哪里找值的方法的接口。
@@ -30,96 +100,516 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// TTLGetter Getter可以同时实现这个接口，为每个加载的值指定过期时间，
+// ttl<=0 时使用缓存的DefaultTTL。
+type TTLGetter interface {
+	GetWithTTL(key string) ([]byte, time.Duration, error)
+}
+
+// TTLGetterFunc 通过一个函数实现Getter和TTLGetter接口。
+type TTLGetterFunc func(key string) ([]byte, time.Duration, error)
+
+// Get 实现Getter接口函数
+func (f TTLGetterFunc) Get(key string) ([]byte, error) {
+	bytes, _, err := f(key)
+	return bytes, err
+}
+
+// GetWithTTL 实现TTLGetter接口函数
+func (f TTLGetterFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(key)
+}
+
+// ContextGetter Getter可以同时实现这个接口，加载时会传入GetContext的ctx，ctx被取消或者超时时应该尽快返回。
+// 同时实现了TTLGetter时优先使用ContextGetter，需要同时传入ctx和指定过期时间时实现ContextTTLGetter。
+type ContextGetter interface {
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+// ContextGetterFunc 通过一个函数实现Getter和ContextGetter接口，Get使用context.Background()。
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+// Get 实现Getter接口函数
+func (f ContextGetterFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
+// GetContext 实现ContextGetter接口函数
+func (f ContextGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// ContextTTLGetter Getter可以同时实现这个接口，加载时传入ctx并为加载的值指定过期时间，
+// 优先于ContextGetter和TTLGetter使用。
+type ContextTTLGetter interface {
+	GetWithTTLContext(ctx context.Context, key string) ([]byte, time.Duration, error)
+}
+
 var (
 	mu sync.RWMutex
+	//groups NewGroup注册的group
+	groups = make(map[string]*GCache)
 )
 
 // NewCache 创建一个新的Group实例
 func NewCache(maxCap int, getter Getter) *GCache {
+	return NewCacheWithOptions(maxCap, getter, Options{})
+}
+
+// NewCacheWithOptions 按opts创建一个新的Group实例
+func NewCacheWithOptions(maxCap int, getter Getter, opts Options) *GCache {
 	if getter == nil {
 		panic("nil Getter")
 	}
+	if r := opts.LRU.OldRatio; r < 0 || r >= 1 {
+		panic("OldRatio must be in (0, 1)")
+	}
+	newPolicy := opts.Policy
+	if newPolicy == nil {
+		newPolicy = LRUPolicy(opts.LRU)
+	}
 	mu.Lock()
 	defer mu.Unlock()
 	c := &GCache{
-		Getter:    getter,
-		MainCache: csCache{maxCap: maxCap},
-		Loader:    &singleflight.Ones{},
+		Getter:     getter,
+		MainCache:  newShardedCache(opts.Shards, maxCap, newPolicy, opts.AdmissionCounters, opts.OnEvicted),
+		Loader:     &singleflight.Group[string, ByteView]{SuccessWindow: opts.LoadReuseWindow, ErrorWindow: opts.LoadErrorReuseWindow},
+		defaultTTL: opts.DefaultTTL,
+	}
+	if opts.NegativeTTL > 0 {
+		negativeCap := opts.NegativeCap
+		if negativeCap == 0 {
+			negativeCap = defaultNegativeCap(maxCap)
+			c.negativeRatio = true
+		}
+		c.negCache = &csCache{maxCap: negativeCap, newPolicy: LRUPolicy(lru.Options{})}
+		c.negativeTTL = opts.NegativeTTL
+	}
+
+	if opts.HotCap > 0 {
+		c.hotCache = &csCache{maxCap: opts.HotCap, newPolicy: LRUPolicy(lru.Options{})}
+		c.hotTTL, c.hotRatio = opts.HotTTL, opts.HotRatio
+		if c.hotTTL <= 0 {
+			c.hotTTL = defaultHotTTL
+		}
+		if c.hotRatio <= 0 {
+			c.hotRatio = defaultHotRatio
+		}
+	}
+
+	interval := opts.SweepInterval
+	if interval == 0 && (opts.DefaultTTL > 0 || opts.NegativeTTL > 0 || opts.HotCap > 0) {
+		interval = defaultSweepInterval
+	}
+	if interval > 0 {
+		c.stopSweep = make(chan struct{})
+		go c.sweep(interval)
 	}
 	return c
 }
 
+// sweep 每隔interval清理一次过期的缓存，直到Close被调用
+func (c *GCache) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n := c.MainCache.removeExpired()
+			if c.negCache != nil {
+				n += c.negCache.removeExpired()
+			}
+			if c.hotCache != nil {
+				n += c.hotCache.removeExpired()
+			}
+			if n > 0 {
+				log.Printf("[gcache] sweep %d expired keys\n", n)
+			}
+		case <-c.stopSweep:
+			return
+		}
+	}
+}
+
+// Close 停止后台清理过期缓存的goroutine，可以重复调用
+func (c *GCache) Close() {
+	c.closeOnce.Do(func() {
+		if c.stopSweep != nil {
+			close(c.stopSweep)
+		}
+	})
+}
+
 // Get 从缓存取值
 func (c *GCache) Get(key string) (ByteView, error) {
+	return c.GetContext(context.Background(), key)
+}
+
+// GetContext 从缓存取值，没有命中时ctx会传给ContextGetter和远端peer，ctx被取消或者超时时返回ctx.Err()
+func (c *GCache) GetContext(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
-		return ByteView{}, fmt.Errorf("key is required\n")
+		return ByteView{}, ErrKeyRequired
+	}
+
+	if v, ok, err := c.lookupCache(key); ok || err != nil {
+		return v, err
+	}
+	if err := ctx.Err(); err != nil {
+		return ByteView{}, err
 	}
 
+	return c.load(ctx, key)
+}
+
+// lookupCache 依次查找本地缓存、热点缓存和负缓存，并更新统计信息；ok和err都为零值时需要加载
+func (c *GCache) lookupCache(key string) (value ByteView, ok bool, err error) {
+	c.stats.gets.Add(1)
 	if v, ok := c.MainCache.get(key); ok {
+		c.stats.hits.Add(1)
 		log.Printf("[gcache] hit %s\n", key)
-		return v, nil
+		return v, true, nil
 	}
+	if c.hotCache != nil {
+		if v, ok := c.hotCache.get(key); ok {
+			c.stats.hits.Add(1)
+			c.stats.hotHits.Add(1)
+			return v, true, nil
+		}
+	}
+	if c.negCache != nil {
+		if _, ok := c.negCache.get(key); ok {
+			c.stats.negativeHits.Add(1)
+			return ByteView{}, false, &Error{Kind: ErrNotFound, Key: key}
+		}
+	}
+	c.stats.misses.Add(1)
+	return ByteView{}, false, nil
+}
 
-	return c.load(key)
+// Set 把value写入key的所有者，ttl<=0 时使用所有者的DefaultTTL，用于更新数据源之后主动刷新缓存
+func (c *GCache) Set(key string, value []byte, ttl time.Duration) error {
+	return c.SetContext(context.Background(), key, value, ttl)
 }
 
+// SetContext 按PickPeer选择key的所有者：所有者是自己时写入本地缓存，否则通过PeerSetter转发给所有者
+func (c *GCache) SetContext(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if key == "" {
+		return ErrKeyRequired
+	}
+	if c.Peers != nil {
+		if peer, ok := c.Peers.PickPeer(key); ok {
+			setter, ok := peer.(PeerSetter)
+			if !ok {
+				return &Error{Kind: ErrPeerUnavailable, Key: key, Err: errors.New("peer does not support Set")}
+			}
+			if err := setter.Set(ctx, key, value, ttl); err != nil {
+				return wrapError(ErrPeerUnavailable, key, err)
+			}
+			//所有者故障时本地加载过的值、热点缓存和负缓存中的记录都已经过时
+			c.deleteLocally(key)
+			return nil
+		}
+	}
+	//复用窗口内的加载结果已经过时
+	c.Loader.Forget(key)
+	c.setCache(key, ByteView{b: cloneBytes(value)}, ttl)
+	return nil
+}
+
+// Delete 删除本地缓存和key的所有者中的key，返回是否有缓存项被删除
 func (c *GCache) Delete(key string) bool {
+	r, _ := c.DeleteContext(context.Background(), key, false)
+	return r.Deleted
+}
+
+// DeleteResult DeleteContext的结果
+type DeleteResult struct {
+	//Deleted 本地或者某个peer确实删除了key
+	Deleted bool
+	//Acked 确认收到删除请求的peer
+	Acked []string
+	//Failed 删除请求失败的peer
+	Failed map[string]error
+}
+
+// DeleteContext 删除本地缓存中的key，然后把删除请求发给key的所有者；
+// broadcast为true并且Peers实现了PeerLister时，发给除自己之外的所有peer，使因为所有者故障而在本地加载过key的节点也失效。
+// 有peer删除失败时返回ErrPeerUnavailable，结果中记录了哪些peer确认、哪些失败。
+func (c *GCache) DeleteContext(ctx context.Context, key string, broadcast bool) (DeleteResult, error) {
+	var r DeleteResult
 	if key == "" {
-		return false
+		return r, ErrKeyRequired
+	}
+	r.Deleted = c.deleteLocally(key)
+
+	var peers []PeerGetter
+	if lister, ok := c.Peers.(PeerLister); ok && broadcast {
+		peers = lister.AllPeers()
+	} else if c.Peers != nil {
+		if peer, ok := c.Peers.PickPeer(key); ok {
+			peers = append(peers, peer)
+		}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		resultMu sync.Mutex
+	)
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(peer PeerGetter) {
+			defer wg.Done()
+			var (
+				deleted bool
+				err     = errors.New("peer does not support Delete")
+			)
+			if d, ok := peer.(PeerDeleter); ok {
+				deleted, err = d.Delete(ctx, key)
+			}
+			resultMu.Lock()
+			defer resultMu.Unlock()
+			if err != nil {
+				if r.Failed == nil {
+					r.Failed = map[string]error{}
+				}
+				r.Failed[peerName(peer)] = err
+				return
+			}
+			r.Acked = append(r.Acked, peerName(peer))
+			r.Deleted = r.Deleted || deleted
+		}(peer)
+	}
+	wg.Wait()
+
+	sort.Strings(r.Acked)
+	if len(r.Failed) == 0 {
+		return r, nil
+	}
+	//按peer名字排序，错误信息不依赖map的遍历顺序
+	failed := make([]string, 0, len(r.Failed))
+	for name := range r.Failed {
+		failed = append(failed, name)
+	}
+	sort.Strings(failed)
+	for i, name := range failed {
+		failed[i] = fmt.Sprintf("%s: %v", name, r.Failed[name])
 	}
-	return c.MainCache.delete(key)
+	return r, &Error{Kind: ErrPeerUnavailable, Key: key, Err: errors.New(strings.Join(failed, "; "))}
 }
 
-// RegisterHTTPPool 注册一个PeerPicker用于选择远端对等体peer
+// deleteLocally 删除本地缓存和负缓存中的key，并让之后的Get不再复用之前的加载结果
+func (c *GCache) deleteLocally(key string) bool {
+	c.Loader.Forget(key)
+	if c.negCache != nil {
+		c.negCache.delete(key)
+	}
+	deleted := false
+	if c.hotCache != nil {
+		deleted = c.hotCache.delete(key)
+	}
+	return c.MainCache.delete(key) || deleted
+}
+
+// Peek 只在本地缓存中查找key，不会加载，也不影响淘汰顺序和统计信息
+func (c *GCache) Peek(key string) (ByteView, bool) {
+	return c.MainCache.peek(key)
+}
+
+// Contains 判断本地缓存中是否有未过期的key，不影响淘汰顺序
+func (c *GCache) Contains(key string) bool {
+	_, ok := c.MainCache.peek(key)
+	return ok
+}
+
+// Len 返回本地缓存k-v的个数
+func (c *GCache) Len() int {
+	return c.MainCache.len()
+}
+
+// Keys 返回本地缓存中所有未过期的key
+func (c *GCache) Keys() []string {
+	var keys []string
+	c.MainCache.rangeEntries(func(e lru.Entry) bool {
+		keys = append(keys, e.Key)
+		return true
+	})
+	return keys
+}
+
+// Range 遍历本地缓存中所有未过期的缓存项，Entry.Value为ByteView，Entry.List为所在的链表，fn返回false时停止。
+// 每个分片先复制再回调，fn中可以访问缓存；遍历不影响淘汰顺序。
+func (c *GCache) Range(fn func(e lru.Entry) bool) {
+	c.MainCache.rangeEntries(fn)
+}
+
+// Resize 在线修改本地缓存的总容量，缩容时分批淘汰超出的缓存项，不会长时间阻塞Get；
+// 使用ArenaPolicy时每个分片还会在持有锁时拷贝一次剩下的缓存项。没有设置NegativeCap时负缓存的容量一起调整
+func (c *GCache) Resize(maxCap int) {
+	c.MainCache.resize(maxCap)
+	if c.negCache != nil && c.negativeRatio {
+		c.negCache.resize(defaultNegativeCap(maxCap))
+	}
+}
+
+// defaultNegativeCap 没有设置NegativeCap时负缓存的容量，csCache的容量为0表示不限制，所以至少为1
+func defaultNegativeCap(maxCap int) int {
+	if n := maxCap / defaultNegativeRatio; n > 0 || maxCap <= 0 {
+		return n
+	}
+	return 1
+}
+
+// Clear 清空本地缓存和负缓存
+func (c *GCache) Clear() {
+	c.MainCache.clear()
+	if c.negCache != nil {
+		c.negCache.clear()
+	}
+	if c.hotCache != nil {
+		c.hotCache.clear()
+	}
+}
+
+// RegisterHTTPPool 注册一个PeerPicker用于选择远端对等体peer。
+// 多个group可以注册同一个HTTPPool，没有名字的GCache作为HTTPPool的默认group，一个HTTPPool只能有一个，重复注册时panic
 func (c *GCache) RegisterHTTPPool(peers PeerPicker) {
 	if c.Peers != nil {
 		panic("RegisterPeerPicker called more than once")
 	}
+	p, isPool := peers.(*HTTPPool)
+	if isPool && c.name == "" && p.cache != nil {
+		panic("RegisterHTTPPool: HTTPPool already has a default group")
+	}
 	c.Peers = peers
+	if isPool {
+		if c.name == "" {
+			p.cache = c
+		} else {
+			c.Peers = &groupPeers{pool: p, group: c.name}
+		}
+	}
 }
 
-func (c *GCache) load(key string) (value ByteView, err error) {
+func (c *GCache) load(ctx context.Context, key string) (value ByteView, err error) {
 	//每个键只获取一次(本地或远程)
 	//不考虑并发调用的数量。
-	viewi, err := c.Loader.Do(key, func() (interface{}, error) {
+	value, err, shared := c.Loader.DoShared(ctx, key, func(ctx context.Context) (ByteView, error) {
 		if c.Peers != nil {
 			//找对等peer
 			if peer, ok := c.Peers.PickPeer(key); ok {
-				if value, err = c.getFromPeer(peer, key); err == nil {
+				value, err := c.getFromPeer(ctx, peer, key)
+				if err == nil {
+					c.stats.peerLoads.Add(1)
+					c.maybeCacheHot(key, value)
 					return value, nil
 				}
-				log.Println("[gcache] The cache key does not yet exist")
+				//peer是key的所有者，它返回的不存在是确定的，不需要再从本地加载
+				if errors.Is(err, ErrNotFound) {
+					c.rememberNotFound(key)
+					return ByteView{}, err
+				}
+				c.stats.peerErrors.Add(1)
+				//所有调用方都已经取消或者超时，不再从本地加载
+				if ctx.Err() != nil {
+					return ByteView{}, err
+				}
+				log.Printf("[gcache] load %s from peer failed: %v\n", key, err)
 			}
 		}
 
-		return c.getLocally(key)
+		value, err := c.getLocally(ctx, key)
+		if err != nil {
+			c.stats.localLoadErrs.Add(1)
+			return ByteView{}, err
+		}
+		c.stats.localLoads.Add(1)
+		return value, nil
 	})
-
-	if err == nil {
-		return viewi.(ByteView), nil
+	if shared {
+		c.stats.dedupLoads.Add(1)
 	}
 	return
 }
 
-func (c *GCache) populateCache(key string, value ByteView) {
-	c.MainCache.add(key, value)
+// populateCache 把加载的值放入缓存，ttl<=0 时使用DefaultTTL
+func (c *GCache) populateCache(key string, value ByteView, ttl time.Duration) {
+	c.MainCache.add(key, value, c.prepareAdd(key, ttl))
+}
+
+// setCache 和populateCache一样，但值来自Set，会记录到准入过滤器
+func (c *GCache) setCache(key string, value ByteView, ttl time.Duration) {
+	c.MainCache.set(key, value, c.prepareAdd(key, ttl))
 }
 
-func (c *GCache) getLocally(key string) (ByteView, error) {
-	bytes, err := c.Getter.Get(key)
+// prepareAdd 删除负缓存中的key，返回ttl对应的过期时间
+func (c *GCache) prepareAdd(key string, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		ttl = c.defaultTTL
+	}
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+	if c.negCache != nil {
+		c.negCache.delete(key)
+	}
+	return expire
+}
+
+// maybeCacheHot 按hotRatio随机地把从peer加载的值放入热点缓存，越热的key被加载的次数越多，越可能被缓存
+func (c *GCache) maybeCacheHot(key string, value ByteView) {
+	if c.hotCache == nil || rand.Intn(c.hotRatio) != 0 {
+		return
+	}
+	c.hotCache.add(key, value, time.Now().Add(c.hotTTL))
+}
+
+// rememberNotFound 启用了负缓存时，在NegativeTTL内记住key不存在
+func (c *GCache) rememberNotFound(key string) {
+	if c.negCache != nil {
+		c.negCache.add(key, ByteView{}, time.Now().Add(c.negativeTTL))
+	}
+}
+
+func (c *GCache) getLocally(ctx context.Context, key string) (ByteView, error) {
+	var (
+		bytes []byte
+		ttl   time.Duration
+		err   error
+	)
+	if g, ok := c.Getter.(ContextTTLGetter); ok {
+		bytes, ttl, err = g.GetWithTTLContext(ctx, key)
+	} else if g, ok := c.Getter.(ContextGetter); ok {
+		bytes, err = g.GetContext(ctx, key)
+	} else if g, ok := c.Getter.(TTLGetter); ok {
+		bytes, ttl, err = g.GetWithTTL(key)
+	} else {
+		bytes, err = c.Getter.Get(key)
+	}
 	if err != nil {
+		err = wrapError(ErrOriginFailed, key, err)
+		if errors.Is(err, ErrNotFound) {
+			c.rememberNotFound(key)
+		}
 		return ByteView{}, err
-
 	}
 	value := ByteView{b: cloneBytes(bytes)}
-	c.populateCache(key, value)
+	c.populateCache(key, value, ttl)
 	return value, nil
 }
 
-func (c *GCache) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
-	bytes, err := peer.Get(key)
+func (c *GCache) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
+	var (
+		bytes []byte
+		err   error
+	)
+	if g, ok := peer.(ContextPeerGetter); ok {
+		bytes, err = g.GetContext(ctx, key)
+	} else {
+		bytes, err = peer.Get(key)
+	}
 	if err != nil {
-		return ByteView{}, err
+		return ByteView{}, wrapError(ErrPeerUnavailable, key, err)
 	}
 	return ByteView{b: bytes}, nil
 }
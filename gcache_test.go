@@ -0,0 +1,407 @@
+package gcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gcache/lru"
+	"gcache/singleflight"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNegativeCache(t *testing.T) {
+	calls := 0
+	c := NewCacheWithOptions(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		calls++
+		if key == "a" {
+			return []byte("aa"), nil
+		}
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}), Options{NegativeTTL: 100 * time.Millisecond})
+	defer c.Close()
+
+	if _, err := c.Get("x"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, 预期 ErrNotFound", err)
+	}
+	if _, err := c.Get("x"); !errors.Is(err, ErrNotFound) || calls != 1 {
+		t.Errorf("负缓存应该直接返回 ErrNotFound, err = %v, calls = %d", err, calls)
+	}
+	if s := c.Stats(); s.NegativeHits != 1 || s.Misses != 1 {
+		t.Errorf("negativeHits/misses = %d/%d, 预期 1/1", s.NegativeHits, s.Misses)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if _, err := c.Get("x"); !errors.Is(err, ErrNotFound) || calls != 2 {
+		t.Errorf("超过 NegativeTTL 应该重新调用 Getter, calls = %d", calls)
+	}
+	//Delete 同时删除负缓存中的记录
+	c.Delete("x")
+	if c.Get("x"); calls != 3 {
+		t.Errorf("Delete 之后应该重新调用 Getter, calls = %d", calls)
+	}
+}
+
+func TestNegativeCacheDisabled(t *testing.T) {
+	calls := 0
+	c := NewCache(1<<10, GetterFunc(func(key string) ([]byte, error) {
+		calls++
+		return nil, ErrNotFound
+	}))
+	c.Get("x")
+	c.Get("x")
+	if calls != 2 {
+		t.Errorf("没有启用负缓存时每次都应该调用 Getter, calls = %d", calls)
+	}
+}
+
+func TestNegativeCacheResize(t *testing.T) {
+	c := NewCacheWithOptions(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), Options{NegativeTTL: time.Minute})
+	defer c.Close()
+	for i := 0; i < 200; i++ {
+		c.Get(fmt.Sprintf("key%d", i))
+	}
+	before := c.negCache.len()
+	//没有设置 NegativeCap 时负缓存的容量随 Resize 调整
+	c.Resize(16 << 10)
+	if n := c.negCache.len(); n == 0 || n >= before || c.negCache.policyStats().Bytes > (16<<10)/defaultNegativeRatio {
+		t.Errorf("负缓存有 %d 个 key, Resize 之前 %d 个", n, before)
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	//Getter 在单独的 goroutine 中执行
+	var calls int64
+	c := NewCache(64<<10, ContextGetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		atomic.AddInt64(&calls, 1)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetContext(ctx, "x"); !errors.Is(err, context.DeadlineExceeded) || atomic.LoadInt64(&calls) != 1 {
+		t.Errorf("err = %v, 预期 context.DeadlineExceeded", err)
+	}
+
+	//已经取消的 ctx 不会调用 Getter
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.GetContext(ctx, "y"); !errors.Is(err, context.Canceled) || atomic.LoadInt64(&calls) != 1 {
+		t.Errorf("err = %v, calls = %d", err, calls)
+	}
+
+	//ContextGetterFunc 也可以作为 Getter 使用
+	if _, err := ContextGetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return nil, ctx.Err()
+	}).Get("z"); err != nil {
+		t.Error("Get 应该使用 context.Background()")
+	}
+}
+
+func TestGetContextShared(t *testing.T) {
+	release := make(chan struct{})
+	var calls int64
+	c := NewCache(64<<10, ContextGetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		atomic.AddInt64(&calls, 1)
+		select {
+		case <-release:
+			return []byte("v"), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	errc := make(chan error)
+	go func() {
+		_, err := c.GetContext(ctx, "x")
+		errc <- err
+	}()
+	done := make(chan ByteView)
+	go func() {
+		v, _ := c.GetContext(context.Background(), "x")
+		done <- v
+	}()
+	//一个调用方超时不会取消共享的加载
+	if err := <-errc; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, 预期 context.DeadlineExceeded", err)
+	}
+	close(release)
+	if v := <-done; v.String() != "v" || atomic.LoadInt64(&calls) != 1 {
+		t.Errorf("获得的 kv 不是预期的: %v, calls = %d", v, calls)
+	}
+	//提前离开的调用方也只算一次合并
+	if s := c.Stats(); s.DedupLoads != 1 {
+		t.Errorf("dedupLoads = %d, 预期 1", s.DedupLoads)
+	}
+}
+
+func TestSet(t *testing.T) {
+	calls := 0
+	c := NewCacheWithOptions(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		calls++
+		return nil, ErrNotFound
+	}), Options{NegativeTTL: time.Minute})
+	c.Get("a")
+	value := []byte("aa")
+	if err := c.Set("a", value, 0); err != nil {
+		t.Fatal(err)
+	}
+	//Set 拷贝 value，并且覆盖负缓存
+	value[0] = 'x'
+	if v, err := c.Get("a"); err != nil || v.String() != "aa" || calls != 1 {
+		t.Errorf("获得的 kv 不是预期的: %v %v", v, err)
+	}
+}
+
+func TestWriteForgetsLoad(t *testing.T) {
+	//使用默认的复用窗口
+	calls := 0
+	c := NewCache(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		calls++
+		return []byte(fmt.Sprint(calls)), nil
+	}))
+	c.Get("a")
+	c.Delete("a")
+	if v, _ := c.Get("a"); v.String() != "2" || calls != 2 {
+		t.Errorf("Delete 之后应该重新调用 Getter: %v, calls = %d", v, calls)
+	}
+	c.Set("a", []byte("S"), 0)
+	c.Delete("a")
+	if v, _ := c.Get("a"); v.String() != "3" || calls != 3 {
+		t.Errorf("Set、Delete 之后应该重新调用 Getter: %v, calls = %d", v, calls)
+	}
+}
+
+func TestLoadReuseWindow(t *testing.T) {
+	calls := 0
+	c := NewCacheWithOptions(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		calls++
+		return nil, errors.New("db down")
+	}), Options{LoadErrorReuseWindow: 50 * time.Millisecond})
+	c.Get("x")
+	c.Get("x")
+	if calls != 1 {
+		t.Errorf("LoadErrorReuseWindow 内应该复用错误, calls = %d", calls)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if c.Get("x"); calls != 2 {
+		t.Errorf("超过 LoadErrorReuseWindow 应该重新加载, calls = %d", calls)
+	}
+	//默认不复用错误
+	d := NewCache(64<<10, c.Getter)
+	d.Get("x")
+	d.Get("x")
+	if calls != 4 {
+		t.Errorf("默认不应该复用错误, calls = %d", calls)
+	}
+}
+
+func TestGetterPanic(t *testing.T) {
+	panics := true
+	c := NewCache(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		if panics {
+			panic("db driver bug")
+		}
+		return []byte("v"), nil
+	}))
+	func() {
+		defer func() {
+			if e, ok := recover().(*singleflight.PanicError); !ok || e.Value != "db driver bug" {
+				t.Errorf("recover() = %v, 预期 *singleflight.PanicError", e)
+			}
+		}()
+		c.Get("a")
+	}()
+	//key 没有留在 Loader 中，之后可以正常加载
+	panics = false
+	if v, err := c.Get("a"); err != nil || v.String() != "v" {
+		t.Errorf("获得的 kv 不是预期的: %v %v", v, err)
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	calls := 0
+	c := NewCacheWithOptions(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		calls++
+		return []byte(key), nil
+	}), Options{DefaultTTL: 30 * time.Millisecond, SweepInterval: -1, LoadReuseWindow: -1})
+	defer c.Close()
+	c.Get("a")
+	if c.Get("a"); calls != 1 {
+		t.Errorf("DefaultTTL 内应该命中缓存, calls = %d", calls)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if c.Contains("a") {
+		t.Error("超过 DefaultTTL 应该过期")
+	}
+	if c.Get("a"); calls != 2 {
+		t.Errorf("过期之后应该重新加载, calls = %d", calls)
+	}
+}
+
+func TestTTLGetter(t *testing.T) {
+	c := NewCacheWithOptions(64<<10, TTLGetterFunc(func(key string) ([]byte, time.Duration, error) {
+		if key == "short" {
+			return []byte(key), 20 * time.Millisecond, nil
+		}
+		//ttl<=0 时使用 DefaultTTL
+		return []byte(key), 0, nil
+	}), Options{DefaultTTL: time.Minute, SweepInterval: -1})
+	defer c.Close()
+	c.Get("short")
+	c.Get("long")
+	time.Sleep(40 * time.Millisecond)
+	if c.Contains("short") {
+		t.Error("TTLGetter 返回的 ttl 应该生效")
+	}
+	if !c.Contains("long") {
+		t.Error("ttl<=0 时应该使用 DefaultTTL")
+	}
+}
+
+// ctxTTLGetter 同时实现了ContextGetter和TTLGetter，只有GetContext返回ctx中的值
+type ctxTTLGetter struct{}
+
+func (g ctxTTLGetter) Get(key string) ([]byte, error) { return nil, errors.New("Get") }
+
+func (g ctxTTLGetter) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return nil, 0, errors.New("GetWithTTL")
+}
+
+func (g ctxTTLGetter) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return []byte(fmt.Sprint(ctx.Value(ctxKey{}))), nil
+}
+
+type ctxKey struct{}
+
+// fullGetter 还实现了ContextTTLGetter
+type fullGetter struct{ ctxTTLGetter }
+
+func (g fullGetter) GetWithTTLContext(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	return []byte(fmt.Sprint(ctx.Value(ctxKey{}))), 20 * time.Millisecond, nil
+}
+
+func TestContextTTLGetter(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ctxKey{}, "ctx")
+	//同时实现 ContextGetter 和 TTLGetter 时不能丢掉 ctx
+	c := NewCacheWithOptions(64<<10, ctxTTLGetter{}, Options{SweepInterval: -1})
+	defer c.Close()
+	if v, err := c.GetContext(ctx, "a"); err != nil || v.String() != "ctx" {
+		t.Errorf("应该使用 GetContext: %v %v", v, err)
+	}
+
+	d := NewCacheWithOptions(64<<10, fullGetter{}, Options{SweepInterval: -1})
+	defer d.Close()
+	if v, err := d.GetContext(ctx, "a"); err != nil || v.String() != "ctx" {
+		t.Errorf("应该使用 GetWithTTLContext: %v %v", v, err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if d.Contains("a") {
+		t.Error("GetWithTTLContext 返回的 ttl 应该生效")
+	}
+}
+
+func TestSweeper(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	opts := Options{DefaultTTL: 10 * time.Millisecond, SweepInterval: 10 * time.Millisecond}
+	c := NewCacheWithOptions(64<<10, getter, opts)
+	defer c.Close()
+	c.Get("a")
+	time.Sleep(60 * time.Millisecond)
+	//后台清理不需要访问 key
+	if s := c.Stats(); s.Items != 0 || s.Expirations != 1 {
+		t.Errorf("过期的缓存项应该被后台清理, stats = %+v", s)
+	}
+
+	//Close 之后不再清理，可以重复调用
+	d := NewCacheWithOptions(64<<10, getter, opts)
+	d.Close()
+	d.Close()
+	d.Get("a")
+	time.Sleep(60 * time.Millisecond)
+	if s := d.Stats(); s.Items != 1 || s.Expirations != 0 {
+		t.Errorf("Close 之后不应该再清理, stats = %+v", s)
+	}
+}
+
+func TestOnEvictedReentrant(t *testing.T) {
+	var c *GCache
+	var reentered, evicted int
+	var set bool
+	c = NewCacheWithOptions(1<<10, GetterFunc(func(key string) ([]byte, error) {
+		return make([]byte, 100), nil
+	}), Options{LoadReuseWindow: -1, OnEvicted: func(key string, value ByteView, reason lru.EvictReason) {
+		evicted++
+		//回调在锁外执行，可以访问缓存本身
+		if reason == lru.EvictCapacity && reentered == 0 {
+			reentered++
+			c.Get(key)
+			c.Set("set-in-callback", []byte("v"), 0)
+			set = c.Contains("set-in-callback")
+		}
+	}})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			c.Get(fmt.Sprintf("key%d", i))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("OnEvicted 中访问缓存死锁")
+	}
+	if reentered != 1 || evicted == 0 || !set {
+		t.Errorf("reentered = %d, evicted = %d", reentered, evicted)
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	value := []byte("value")
+	size := func() int64 {
+		c := NewCache(64<<10, GetterFunc(func(key string) ([]byte, error) { return nil, ErrNotFound }))
+		c.Set("key0", value, 0)
+		return c.Stats().Bytes
+	}()
+	//容量正好放下 4 个 kv
+	c := NewCacheWithOptions(int(4*size), GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), Options{AdmissionCounters: 1024})
+	for i := 0; i < 4; i++ {
+		key := fmt.Sprintf("key%d", i)
+		c.Set(key, value, 0)
+		for j := 0; j < 5; j++ {
+			c.Get(key)
+		}
+	}
+	//冷 key 不能淘汰热 key
+	c.Set("cold", value, 0)
+	if c.Contains("cold") || c.Len() != 4 {
+		t.Errorf("冷 key 不应该被准入, keys = %v", c.Keys())
+	}
+	//只写不读的 key 随着写入次数增加也能被准入
+	for i := 0; i < 10 && !c.Contains("warm"); i++ {
+		c.Set("warm", value, 0)
+	}
+	if !c.Contains("warm") {
+		t.Errorf("多次写入的 key 应该被准入, keys = %v", c.Keys())
+	}
+	//通过 Getter 加载的 key 每次加载只记录一次，Set 写入的 key 也记录一次
+	d := NewCacheWithOptions(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		return value, nil
+	}), Options{AdmissionCounters: 1024})
+	d.Get("loaded")
+	d.Set("written", value, 0)
+	for _, key := range []string{"loaded", "written"} {
+		if n := d.MainCache.shard(key).admission.Estimate(key); n != 1 {
+			t.Errorf("%s 的访问频率为 %d, 预期 1", key, n)
+		}
+	}
+}
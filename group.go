@@ -0,0 +1,82 @@
+package gcache
+
+import (
+	"net/url"
+	"strings"
+)
+
+// defaultGroup 没有名字的GCache(NewCache创建)在peer之间使用的group名字
+const defaultGroup = "default"
+
+// NewGroup 按opts创建一个名为name的GCache并注册，之后可以通过GetGroup(name)获得；
+// 多个group可以注册同一个HTTPPool，peer之间按 /<basepath>/<group>/<key> 把请求路由到同名的group。
+// 名字为空、包含"/"、是保留给没有名字的GCache的defaultGroup或者重复时panic
+func NewGroup(name string, maxCap int, getter Getter, opts Options) *GCache {
+	if name == "" || name == defaultGroup || strings.Contains(name, "/") {
+		panic("bad group name: " + name)
+	}
+	c := NewCacheWithOptions(maxCap, getter, opts)
+	c.name = name
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := groups[name]; dup {
+		c.Close()
+		panic("duplicate registration of group " + name)
+	}
+	groups[name] = c
+	return c
+}
+
+// unregisterGroup 删除NewGroup注册的group，测试结束时调用，使测试可以重复运行
+func unregisterGroup(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if c, ok := groups[name]; ok {
+		c.Close()
+		delete(groups, name)
+	}
+}
+
+// GetGroup 返回NewGroup创建的名为name的GCache，不存在时返回nil
+func GetGroup(name string) *GCache {
+	mu.RLock()
+	defer mu.RUnlock()
+	return groups[name]
+}
+
+// Name 返回NewGroup指定的名字，NewCache创建的GCache返回空字符串
+func (c *GCache) Name() string {
+	return c.name
+}
+
+// groupPeers 把HTTPPool选出的peer限定到某个group，请求发给peer上的同名group
+type groupPeers struct {
+	pool  *HTTPPool
+	group string
+}
+
+func (g *groupPeers) PickPeer(key string) (PeerGetter, bool) {
+	peer, ok := g.pool.PickPeer(key)
+	if !ok {
+		return nil, false
+	}
+	return peer.(*httpGetter).withGroup(g.group), true
+}
+
+func (g *groupPeers) AllPeers() []PeerGetter {
+	peers := g.pool.AllPeers()
+	for i, peer := range peers {
+		peers[i] = peer.(*httpGetter).withGroup(g.group)
+	}
+	return peers
+}
+
+var (
+	_ PeerPicker = (*groupPeers)(nil)
+	_ PeerLister = (*groupPeers)(nil)
+)
+
+// withGroup 返回请求发给group的httpGetter
+func (h *httpGetter) withGroup(group string) *httpGetter {
+	return &httpGetter{baseURL: h.baseURL, group: url.PathEscape(group)}
+}
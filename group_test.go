@@ -0,0 +1,92 @@
+package gcache
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestGroup 创建名为name的group，测试结束时删除
+func newTestGroup(t *testing.T, name, prefix string) *GCache {
+	c := NewGroup(name, 64<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(prefix + key), nil
+	}), Options{})
+	t.Cleanup(func() { unregisterGroup(name) })
+	return c
+}
+
+func TestGroups(t *testing.T) {
+	users := newTestGroup(t, "test-users", "user-")
+	products := newTestGroup(t, "test-products", "product-")
+	if GetGroup("test-users") != users || GetGroup("test-products") != products || GetGroup("test-none") != nil {
+		t.Fatal("GetGroup 的结果不是预期的")
+	}
+	if users.Name() != "test-users" || NewCache(1, users.Getter).Name() != "" {
+		t.Error("Name 的结果不是预期的")
+	}
+
+	pool := NewHTTPPool("owner")
+	users.RegisterHTTPPool(pool)
+	products.RegisterHTTPPool(pool)
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	//模拟另一个节点上的同名 group
+	for name, prefix := range map[string]string{"test-users": "user-", "test-products": "product-", "test-none": ""} {
+		c := NewCache(64<<10, GetterFunc(func(key string) ([]byte, error) {
+			return nil, errors.New("should load from peer")
+		}))
+		c.name = name
+		p := NewHTTPPool("self")
+		p.AddPeers(srv.URL)
+		c.RegisterHTTPPool(p)
+
+		v, err := c.Get("1")
+		if prefix == "" {
+			//peer 上没有这个 group 时不能当成 key 不存在
+			if _, ok := c.Peers.PickPeer("1"); !ok {
+				t.Fatal("应该选择 peer")
+			}
+			if _, err := c.Peers.(*groupPeers).AllPeers()[0].Get("1"); !errors.Is(err, ErrPeerUnavailable) {
+				t.Errorf("err = %v, 预期 ErrPeerUnavailable", err)
+			}
+			continue
+		}
+		if err != nil || v.String() != prefix+"1" {
+			t.Errorf("%s: 获得的 kv 不是预期的: %v %v", name, v, err)
+		}
+	}
+}
+
+func TestGroupDuplicate(t *testing.T) {
+	newTestGroup(t, "test-dup", "")
+	defer func() {
+		if recover() == nil {
+			t.Error("重复注册 group 应该 panic")
+		}
+	}()
+	newTestGroup(t, "test-dup", "")
+}
+
+func TestGroupReservedName(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("NewGroup 使用 defaultGroup 的名字应该 panic")
+		}
+	}()
+	NewGroup(defaultGroup, 64<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), Options{})
+}
+
+func TestDefaultGroupDuplicate(t *testing.T) {
+	pool := NewHTTPPool("self")
+	getter := GetterFunc(func(key string) ([]byte, error) { return nil, ErrNotFound })
+	NewCache(64<<10, getter).RegisterHTTPPool(pool)
+	defer func() {
+		if recover() == nil {
+			t.Error("HTTPPool 已经有默认 group 时应该 panic")
+		}
+	}()
+	NewCache(64<<10, getter).RegisterHTTPPool(pool)
+}
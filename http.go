@@ -1,6 +1,10 @@
 package gcache
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"gcache/consistenthash"
 	"io/ioutil"
@@ -9,13 +13,35 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
 	defaultBasePath = "/gcache"
 	defaultReplicas = 30
+	// ttlHeader PUT请求中缓存项的过期时间(time.Duration的字符串)，没有时使用所有者的DefaultTTL
+	ttlHeader = "X-Gcache-Ttl"
+	// timeoutHeader 请求方剩余的超时时间(time.Duration的字符串)，用剩余时间而不是截止时刻，不受节点之间时钟偏差的影响
+	timeoutHeader = "X-Gcache-Timeout"
 )
 
+// batchRequest 批量获取的请求，POST <basepath>/<group>/
+type batchRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// batchResponse 批量获取的响应，Values和Errors中都没有的key不存在
+type batchResponse struct {
+	Values map[string][]byte     `json:"values"`
+	Errors map[string]batchError `json:"errors,omitempty"`
+}
+
+// batchError 一个key的错误，Status为StatusCode(err)，请求方按errorFromStatus还原错误分类
+type batchError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
 // HTTPPool 为HTTP对等体池实现PeerPicker。
 type HTTPPool struct {
 	self        string //自己的url+port
@@ -23,6 +49,8 @@ type HTTPPool struct {
 	mu          sync.Mutex // 防止并发访问peers和httpGetters
 	peers       *consistenthash.Map
 	httpGetters map[string]*httpGetter
+	//cache 默认group，处理发给defaultGroup的请求，由没有名字的GCache调用RegisterHTTPPool设置
+	cache *GCache
 }
 
 // NewHTTPPool 初始化HTTP对等体池。
@@ -40,21 +68,92 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		log.Panicf("HTTPPool serving unexpected path: %s, expect %s\n", r.URL.Path, p.basePath)
 	}
 	log.Printf("[Server %s] %s\n", p.self, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
-	// url:port/<basepath>/<key>
-	key := r.URL.Path[len(p.basePath)+1:]
+	// url:port/<basepath>/<group>/<key>
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path[len(p.basePath):], "/"), "/", 2)
+	if len(parts) != 2 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	groupName, key := parts[0], parts[1]
 
-	peer, ok := p.PickPeer(key)
-	if !ok {
-		log.Fatalf("PickPeer %s not find peer\n", key)
+	cache := GetGroup(groupName)
+	if cache == nil && groupName == defaultGroup {
+		cache = p.cache
 	}
-	view, err := peer.Get(key)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if cache == nil {
+		//group不存在是配置问题，不能当成key不存在
+		http.Error(w, "no such group: "+groupName, http.StatusServiceUnavailable)
 		return
 	}
+	ctx := r.Context()
+	if d, err := time.ParseDuration(r.Header.Get(timeoutHeader)); err == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
 
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Write(view)
+	switch r.Method {
+	case http.MethodGet:
+		view, err := cache.GetContext(ctx, key)
+		if err != nil {
+			http.Error(w, err.Error(), StatusCode(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(view.ByteSlice())
+	case http.MethodPut:
+		value, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl, _ := time.ParseDuration(r.Header.Get(ttlHeader))
+		if err := cache.SetContext(ctx, key, value, ttl); err != nil {
+			http.Error(w, err.Error(), StatusCode(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		//只删除本地，不再转发，避免广播时互相转发
+		if key == "" {
+			http.Error(w, ErrKeyRequired.Error(), http.StatusBadRequest)
+			return
+		}
+		if !cache.deleteLocally(key) {
+			http.Error(w, ErrNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPost:
+		//批量获取，请求和响应都是JSON
+		var req batchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		values, err := cache.GetMultiContext(ctx, req.Keys)
+		var errs MultiError
+		if err != nil && !errors.As(err, &errs) {
+			//ctx结束时部分key没有结果，不能让请求方当成不存在
+			http.Error(w, err.Error(), StatusCode(err))
+			return
+		}
+		res := batchResponse{Values: make(map[string][]byte, len(values))}
+		for key, v := range values {
+			res.Values[key] = v.ByteSlice()
+		}
+		if len(errs) > 0 {
+			res.Errors = make(map[string]batchError, len(errs))
+			for key, err := range errs {
+				res.Errors[key] = batchError{Status: StatusCode(err), Message: err.Error()}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
 }
 
 // AddPeers 将节点虚拟化多个并且放入HTTPPool，peer为ip+port
@@ -77,6 +176,9 @@ func (p *HTTPPool) AddPeers(peers ...string) {
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
 	if peer := p.peers.GetPeer(key); peer != "" && peer != p.self {
 		log.Printf("Pick peer %s\n", peer)
 		return p.httpGetters[peer], true
@@ -84,36 +186,130 @@ func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	return nil, false
 }
 
-var _ PeerPicker = (*HTTPPool)(nil)
+// AllPeers 返回除自己之外的所有peer
+func (p *HTTPPool) AllPeers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]PeerGetter, 0, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
+
+var (
+	_ PeerPicker = (*HTTPPool)(nil)
+	_ PeerLister = (*HTTPPool)(nil)
+)
 
 //http客户端
 type httpGetter struct {
 	baseURL string
+	//group 请求发给peer上的哪个group，已经转义，空字符串表示defaultGroup
+	group string
 }
 
 // Get 实现了PeerGetter 接口
 func (h *httpGetter) Get(key string) ([]byte, error) {
+	return h.GetContext(context.Background(), key)
+}
+
+// GetContext 实现了ContextPeerGetter 接口，ctx有截止时间时把剩余的时间通过timeoutHeader传给远端peer
+func (h *httpGetter) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return h.do(ctx, http.MethodGet, key, nil, nil)
+}
+
+// Set 实现了PeerSetter 接口，通过PUT把值写入远端peer
+func (h *httpGetter) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	header := http.Header{}
+	if ttl > 0 {
+		header.Set(ttlHeader, ttl.String())
+	}
+	_, err := h.do(ctx, http.MethodPut, key, value, header)
+	return err
+}
+
+// Delete 实现了PeerDeleter 接口，删除远端peer本地缓存中的key
+func (h *httpGetter) Delete(ctx context.Context, key string) (bool, error) {
+	_, err := h.do(ctx, http.MethodDelete, key, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetMulti 实现了BatchPeerGetter 接口，通过一次POST获取多个key
+func (h *httpGetter) GetMulti(ctx context.Context, keys []string) (map[string][]byte, map[string]error, error) {
+	body, err := json.Marshal(batchRequest{Keys: keys})
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	data, err := h.do(ctx, http.MethodPost, "", body, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	var res batchResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, nil, &Error{Kind: ErrPeerUnavailable, Err: fmt.Errorf("decoding batch response: %v", err)}
+	}
+	errs := make(map[string]error, len(res.Errors))
+	for key, e := range res.Errors {
+		errs[key] = errorFromStatus(e.Status, key, e.Message)
+	}
+	return res.Values, errs, nil
+}
+
+func (h *httpGetter) String() string {
+	return h.baseURL
+}
+
+// do 向远端peer发送请求，返回响应的内容，状态码不是2xx时按errorFromStatus还原错误分类
+func (h *httpGetter) do(ctx context.Context, method, key string, body []byte, header http.Header) ([]byte, error) {
+	group := h.group
+	if group == "" {
+		group = defaultGroup
+	}
 	u := fmt.Sprintf(
-		"%v/%v\n",
+		"%v/%v/%v",
 		h.baseURL,
-		url.QueryEscape(key),
+		group,
+		url.PathEscape(key),
 	)
-	res, err := http.Get(u)
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
 	if err != nil {
-		return nil, err
+		return nil, &Error{Kind: ErrPeerUnavailable, Key: key, Err: err}
 	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned: %v\n", res.Status)
+	for k, v := range header {
+		req.Header[k] = v
 	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set(timeoutHeader, time.Until(deadline).String())
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, &Error{Kind: ErrPeerUnavailable, Key: key, Err: err}
+	}
+	defer res.Body.Close()
 
-	bytes, err := ioutil.ReadAll(res.Body)
+	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return nil, fmt.Errorf("reading response body: %v\n", err)
+		return nil, &Error{Kind: ErrPeerUnavailable, Key: key, Err: fmt.Errorf("reading response body: %v", err)}
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, errorFromStatus(res.StatusCode, key, strings.TrimSpace(string(data)))
 	}
 
-	return bytes, nil
+	return data, nil
 }
 
-var _ PeerGetter = (*httpGetter)(nil)
+var (
+	_ PeerGetter        = (*httpGetter)(nil)
+	_ ContextPeerGetter = (*httpGetter)(nil)
+	_ PeerSetter        = (*httpGetter)(nil)
+	_ PeerDeleter       = (*httpGetter)(nil)
+	_ BatchPeerGetter   = (*httpGetter)(nil)
+)
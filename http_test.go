@@ -0,0 +1,304 @@
+package gcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPErrors(t *testing.T) {
+	c := NewCache(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		switch key {
+		case "a b/c":
+			return []byte("ok"), nil
+		case "missing":
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, errors.New("db down")
+	}))
+	pool := NewHTTPPool("self")
+	c.RegisterHTTPPool(pool)
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	//key 中的空格和 / 需要转义
+	if v, err := getter.Get("a b/c"); err != nil || string(v) != "ok" {
+		t.Errorf("获得的 kv 不是预期的: %s %v", v, err)
+	}
+	for key, want := range map[string]error{"missing": ErrNotFound, "other": ErrOriginFailed, "": ErrKeyRequired} {
+		_, err := getter.Get(key)
+		if !errors.Is(err, want) {
+			t.Errorf("%q: err = %v, 预期 %v", key, err, want)
+		}
+	}
+
+	srv.Close()
+	if _, err := getter.Get("a b/c"); !errors.Is(err, ErrPeerUnavailable) {
+		t.Errorf("err = %v, 预期 ErrPeerUnavailable", err)
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	c := NewCache(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("db down")
+	}))
+	if _, err := c.Get(""); err != ErrKeyRequired {
+		t.Errorf("err = %v, 预期 ErrKeyRequired", err)
+	}
+	_, err := c.Get("x")
+	var e *Error
+	if !errors.Is(err, ErrOriginFailed) || !errors.As(err, &e) || e.Key != "x" || e.Err.Error() != "db down" {
+		t.Errorf("err = %v, 预期 ErrOriginFailed", err)
+	}
+	for err, code := range map[error]int{
+		ErrNotFound:         http.StatusNotFound,
+		ErrKeyRequired:      http.StatusBadRequest,
+		ErrOriginFailed:     http.StatusBadGateway,
+		ErrPeerUnavailable:  http.StatusServiceUnavailable,
+		errors.New("other"): http.StatusInternalServerError,
+	} {
+		if StatusCode(&Error{Kind: err}) != code && StatusCode(err) != code {
+			t.Errorf("StatusCode(%v) != %d", err, code)
+		}
+	}
+}
+
+func TestPeerNotFound(t *testing.T) {
+	_, srv := startOwner(t, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}), nil)
+
+	calls := 0
+	c := NewCacheWithOptions(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		calls++
+		return []byte("local"), nil
+	}), Options{NegativeTTL: time.Minute})
+	usePeer(c, srv.URL)
+
+	//所有者返回的不存在是确定的，不应该再从本地加载
+	if _, err := c.Get("x"); !errors.Is(err, ErrNotFound) || calls != 0 {
+		t.Errorf("err = %v, calls = %d", err, calls)
+	}
+	if _, ok := c.negCache.peek("x"); !ok {
+		t.Error("peer 返回的 ErrNotFound 应该加入负缓存")
+	}
+	if s := c.Stats(); s.PeerErrors != 0 {
+		t.Errorf("peer 返回的 ErrNotFound 不算作加载失败, peerErrors = %d", s.PeerErrors)
+	}
+	//peer 不可用时从本地加载
+	srv.Close()
+	if v, err := c.Get("y"); err != nil || v.String() != "local" || calls != 1 {
+		t.Errorf("peer 不可用时应该从本地加载: %v %v", v, err)
+	}
+	if s := c.Stats(); s.PeerErrors != 1 {
+		t.Errorf("peerErrors = %d, 预期 1", s.PeerErrors)
+	}
+}
+
+func TestPeerDeadline(t *testing.T) {
+	_, srv := startOwner(t, ContextGetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) > time.Second {
+			return nil, errors.New("deadline not propagated")
+		}
+		if key == "slow" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return []byte("ok"), nil
+	}), nil)
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if v, err := getter.GetContext(ctx, "a"); err != nil || string(v) != "ok" {
+		t.Errorf("截止时间应该传给远端 peer: %s %v", v, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := getter.GetContext(ctx, "slow"); err == nil || time.Since(start) > 400*time.Millisecond {
+		t.Errorf("超时之后应该尽快返回, err = %v", err)
+	}
+}
+
+func TestPeerSet(t *testing.T) {
+	notFound := GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	})
+	owner, srv := startOwner(t, notFound, nil)
+	c := NewCache(64<<10, notFound)
+	//所有者故障时在本地加载过的旧值
+	c.populateCache("a", ByteView{b: []byte("old")}, 0)
+	usePeer(c, srv.URL)
+
+	//key 的所有者是 owner，值写入 owner 而不是本地
+	if err := c.Set("a", []byte("aa"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := owner.Peek("a"); !ok || v.String() != "aa" {
+		t.Errorf("值应该写入所有者: %v %v", v, ok)
+	}
+	if c.Contains("a") {
+		t.Error("值不应该写入本地，本地的旧值应该被删除")
+	}
+	if v, err := c.Get("a"); err != nil || v.String() != "aa" {
+		t.Errorf("获得的 kv 不是预期的: %v %v", v, err)
+	}
+
+	if err := c.Set("b", []byte("bb"), 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if owner.Contains("b") {
+		t.Error("ttl 应该传给所有者")
+	}
+	if err := c.Set("", nil, 0); err != ErrKeyRequired {
+		t.Errorf("err = %v, 预期 ErrKeyRequired", err)
+	}
+}
+
+func TestPeerDelete(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	})
+	nodes := map[string]*GCache{}
+	var urls []string
+	for i := 0; i < 2; i++ {
+		node := NewCache(64<<10, getter)
+		pool := NewHTTPPool(fmt.Sprintf("node%d", i))
+		node.RegisterHTTPPool(pool)
+		srv := httptest.NewServer(pool)
+		defer srv.Close()
+		node.Set("k", []byte("v"), 0)
+		nodes[srv.URL+defaultBasePath] = node
+		urls = append(urls, srv.URL)
+	}
+
+	c := NewCache(64<<10, getter)
+	pool := NewHTTPPool("self")
+	pool.AddPeers(urls...)
+	c.RegisterHTTPPool(pool)
+	peer, _ := pool.PickPeer("k")
+	owner := peerName(peer)
+
+	//只删除所有者
+	r, err := c.DeleteContext(context.Background(), "k", false)
+	if err != nil || !r.Deleted || fmt.Sprint(r.Acked) != fmt.Sprint([]string{owner}) {
+		t.Errorf("result = %+v, err = %v", r, err)
+	}
+	for name, node := range nodes {
+		if node.Contains("k") != (name != owner) {
+			t.Errorf("%s 中的 k 不是预期的", name)
+		}
+	}
+
+	//广播给所有 peer
+	r, err = c.DeleteContext(context.Background(), "k", true)
+	if err != nil || !r.Deleted || len(r.Acked) != 2 {
+		t.Errorf("result = %+v, err = %v", r, err)
+	}
+	for name, node := range nodes {
+		if node.Contains("k") {
+			t.Errorf("%s 中的 k 应该被删除", name)
+		}
+	}
+	if r, _ = c.DeleteContext(context.Background(), "k", true); r.Deleted || len(r.Acked) != 2 {
+		t.Errorf("k 已经不存在, result = %+v", r)
+	}
+}
+
+func TestPeerDeleteFailed(t *testing.T) {
+	c := NewCache(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}))
+	var urls []string
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+		urls = append(urls, srv.URL)
+	}
+	pool := NewHTTPPool("self")
+	pool.AddPeers(urls...)
+	c.RegisterHTTPPool(pool)
+	r, err := c.DeleteContext(context.Background(), "k", true)
+	if !errors.Is(err, ErrPeerUnavailable) || len(r.Failed) != 2 || len(r.Acked) != 0 {
+		t.Errorf("result = %+v, err = %v", r, err)
+	}
+	//错误中按名字排序列出所有失败的 peer
+	sort.Strings(urls)
+	msg := err.Error()
+	if i, j := strings.Index(msg, urls[0]), strings.Index(msg, urls[1]); i < 0 || j < i {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestHotCache(t *testing.T) {
+	loads := 0
+	_, srv := startOwner(t, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key + key), nil
+	}), nil)
+
+	c := NewCacheWithOptions(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), Options{HotCap: 16 << 10, HotRatio: 1, HotTTL: 100 * time.Millisecond, LoadReuseWindow: -1})
+	defer c.Close()
+	usePeer(c, srv.URL)
+
+	for i := 0; i < 3; i++ {
+		if v, err := c.Get("a"); err != nil || v.String() != "aa" {
+			t.Fatalf("获得的 kv 不是预期的: %v %v", v, err)
+		}
+	}
+	s := c.Stats()
+	if s.PeerLoads != 1 || s.HotHits != 2 || s.Hits != 2 || s.HotItems != 1 || s.HotBytes == 0 {
+		t.Errorf("stats = %+v", s)
+	}
+	if s.Items != 0 || c.Contains("a") {
+		t.Error("从 peer 加载的值不应该放入 MainCache")
+	}
+
+	//超过 HotTTL 之后重新从 peer 加载
+	time.Sleep(150 * time.Millisecond)
+	c.Get("a")
+	if s := c.Stats(); s.PeerLoads != 2 {
+		t.Errorf("peerLoads = %d, 预期 2", s.PeerLoads)
+	}
+	//Delete 同时删除热点缓存
+	c.Delete("a")
+	if s := c.Stats(); s.HotItems != 0 {
+		t.Errorf("hotItems = %d, 预期 0", s.HotItems)
+	}
+}
+
+// startOwner 用getter创建所有者并通过httptest.Server提供服务，测试结束时关闭；
+// before不为nil时每个请求先交给before
+func startOwner(t *testing.T, getter Getter, before func(r *http.Request)) (*GCache, *httptest.Server) {
+	owner := NewCache(64<<10, getter)
+	pool := NewHTTPPool("owner")
+	owner.RegisterHTTPPool(pool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if before != nil {
+			before(r)
+		}
+		pool.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return owner, srv
+}
+
+// usePeer 让c的所有key都属于url上的peer
+func usePeer(c *GCache, url string) {
+	pool := NewHTTPPool("self")
+	pool.AddPeers(url)
+	c.RegisterHTTPPool(pool)
+}
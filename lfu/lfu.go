@@ -0,0 +1,268 @@
+package lfu
+
+import (
+	"container/list"
+	"gcache/lru"
+	"time"
+)
+
+// Cache Cache为LFU缓存，访问次数相同时淘汰最久没有访问的key，并发访问是不安全的。
+// 所有操作都是O(1)的：相同访问次数的key放在同一个频率桶里，频率桶按访问次数升序排列。
+type Cache struct {
+	//最大容量，0表示不限制
+	maxCap int
+	//已经使用了的容量
+	usedMem int
+	//频率桶链表，元素为*freqNode，按freq升序
+	freqs *list.List
+	mp    map[string]*list.Element
+
+	// OnEvicted 可选，缓存项被移除时调用
+	OnEvicted func(key string, value lru.Value, reason lru.EvictReason)
+}
+
+// freqNode 频率桶，entries 中的key访问次数都为freq，越靠前越近被访问
+type freqNode struct {
+	freq    int
+	entries *list.List
+}
+
+type entry struct {
+	key   string
+	value lru.Value
+	//过期时间，零值表示永不过期
+	expire time.Time
+	//所在的频率桶
+	node *list.Element
+}
+
+// expired 判断entry在now时刻是否已经过期
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+// New 创造一个缓存。
+func New(maxCap int) *Cache {
+	return &Cache{
+		maxCap: maxCap,
+		freqs:  list.New(),
+		mp:     map[string]*list.Element{},
+	}
+}
+
+// evicted 回调OnEvicted
+func (c *Cache) evicted(kv *entry, reason lru.EvictReason) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value, reason)
+	}
+}
+
+// increment 把key移动到访问次数+1的频率桶
+func (c *Cache) increment(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	cur := kv.node
+	freq := cur.Value.(*freqNode).freq + 1
+
+	next := cur.Next()
+	if next == nil || next.Value.(*freqNode).freq != freq {
+		next = c.freqs.InsertAfter(&freqNode{freq: freq, entries: list.New()}, cur)
+	}
+	c.unlink(ele)
+	kv.node = next
+	c.mp[kv.key] = next.Value.(*freqNode).entries.PushFront(kv)
+}
+
+// unlink 把key从所在的频率桶移除，频率桶为空时一并移除
+func (c *Cache) unlink(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	node := kv.node.Value.(*freqNode)
+	node.entries.Remove(ele)
+	if node.entries.Len() == 0 {
+		c.freqs.Remove(kv.node)
+	}
+}
+
+// remove 删除某个key
+func (c *Cache) remove(ele *list.Element) *entry {
+	kv := ele.Value.(*entry)
+	c.unlink(ele)
+	delete(c.mp, kv.key)
+	c.usedMem -= len(kv.key) + kv.value.Len()
+	return kv
+}
+
+// removeVictim 根据lfu的规则删除一个k-v：访问次数最少的频率桶里最久没有访问的key。
+func (c *Cache) removeVictim() {
+	front := c.freqs.Front()
+	if front == nil {
+		return
+	}
+	kv := c.remove(front.Value.(*freqNode).entries.Back())
+	c.evicted(kv, lru.EvictCapacity)
+}
+
+// Add 添加一个永不过期的值。
+func (c *Cache) Add(key string, value lru.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 添加一个值，expire为过期时间，零值表示永不过期。已存在的key访问次数+1。
+func (c *Cache) AddWithExpire(key string, value lru.Value, expire time.Time) {
+	if ele, ok := c.mp[key]; ok {
+		kv := ele.Value.(*entry)
+		c.usedMem += value.Len() - kv.value.Len()
+		replaced := *kv
+		kv.value = value
+		kv.expire = expire
+		c.increment(ele)
+		c.evicted(&replaced, lru.EvictReplaced)
+	} else {
+		//先淘汰再加入，避免新加入的key(访问次数为1)被立即淘汰
+		size := len(key) + value.Len()
+		for c.maxCap != 0 && c.maxCap < c.usedMem+size && len(c.mp) > 0 {
+			c.removeVictim()
+		}
+		front := c.freqs.Front()
+		if front == nil || front.Value.(*freqNode).freq != 1 {
+			front = c.freqs.PushFront(&freqNode{freq: 1, entries: list.New()})
+		}
+		kv := &entry{key: key, value: value, expire: expire, node: front}
+		c.mp[key] = front.Value.(*freqNode).entries.PushFront(kv)
+		c.usedMem += size
+	}
+	for c.overflow() {
+		c.removeVictim()
+	}
+}
+
+// Victim 返回加入key之后最先被淘汰的key，key已经存在或者加入key不需要淘汰时ok为false。
+func (c *Cache) Victim(key string, value lru.Value) (victim string, ok bool) {
+	if _, ok := c.mp[key]; ok {
+		return "", false
+	}
+	front := c.freqs.Front()
+	if c.maxCap == 0 || c.usedMem+len(key)+value.Len() <= c.maxCap || front == nil {
+		return "", false
+	}
+	return front.Value.(*freqNode).entries.Back().Value.(*entry).key, true
+}
+
+// Get 查找的key的值并把访问次数+1，已过期的key会被删除并视为不存在。
+func (c *Cache) Get(key string) (value lru.Value, ok bool) {
+	ele, ok := c.mp[key]
+	if !ok {
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	if kv.expired(time.Now()) {
+		c.remove(ele)
+		c.evicted(kv, lru.EvictExpired)
+		return nil, false
+	}
+	c.increment(ele)
+	return kv.value, true
+}
+
+// Peek 查找key的值，不增加访问次数，也不会删除已过期的key，已过期的key视为不存在。
+func (c *Cache) Peek(key string) (value lru.Value, ok bool) {
+	ele, ok := c.mp[key]
+	if !ok {
+		return nil, false
+	}
+	if kv := ele.Value.(*entry); !kv.expired(time.Now()) {
+		return kv.value, true
+	}
+	return nil, false
+}
+
+// Delete 删除某key
+func (c *Cache) Delete(key string) bool {
+	ele, ok := c.mp[key]
+	if !ok {
+		return false
+	}
+	c.evicted(c.remove(ele), lru.EvictDeleted)
+	return true
+}
+
+// RemoveExpired 删除所有已过期的k-v，返回删除的个数。
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, ele := range c.mp {
+		if kv := ele.Value.(*entry); kv.expired(now) {
+			c.remove(ele)
+			c.evicted(kv, lru.EvictExpired)
+			n++
+		}
+	}
+	return n
+}
+
+// Resize 修改容量，不会立即淘汰，超出的部分由Trim或者之后的Add淘汰。
+func (c *Cache) Resize(maxCap int) {
+	c.maxCap = maxCap
+}
+
+// Trim 超出容量时最多淘汰n个k-v，返回是否已经不超出容量。
+func (c *Cache) Trim(n int) bool {
+	for ; n > 0 && c.overflow(); n-- {
+		c.removeVictim()
+	}
+	return !c.overflow()
+}
+
+// overflow 判断是否超出容量
+func (c *Cache) overflow() bool {
+	return c.maxCap != 0 && c.maxCap < c.usedMem
+}
+
+// Len 返回缓存k-v的个数。
+func (c *Cache) Len() int {
+	return len(c.mp)
+}
+
+// Snapshot 返回所有未过期的缓存项，按访问次数从少到多，访问次数相同时按从最久没访问到最近访问的顺序。
+func (c *Cache) Snapshot() []lru.Entry {
+	now := time.Now()
+	entries := make([]lru.Entry, 0, len(c.mp))
+	for node := c.freqs.Front(); node != nil; node = node.Next() {
+		for ele := node.Value.(*freqNode).entries.Back(); ele != nil; ele = ele.Prev() {
+			if kv := ele.Value.(*entry); !kv.expired(now) {
+				entries = append(entries, lru.Entry{Key: kv.key, Value: kv.value, Expire: kv.expire, List: "lfu"})
+			}
+		}
+	}
+	return entries
+}
+
+// Restore 把快照中的缓存项加入缓存，访问次数重新计为1
+func (c *Cache) Restore(e lru.Entry) {
+	if ele, ok := c.mp[e.Key]; ok {
+		c.remove(ele)
+	}
+	c.AddWithExpire(e.Key, e.Value, e.Expire)
+}
+
+// Stats 返回缓存的统计信息，LFU没有晋升。
+func (c *Cache) Stats() lru.Stats {
+	return lru.Stats{
+		Bytes: int64(c.usedMem),
+		Items: int64(len(c.mp)),
+		Lists: []lru.ListStats{{Name: "lfu", Bytes: int64(c.usedMem), Items: int64(len(c.mp))}},
+	}
+}
+
+// Clear 清空缓存，保留容量设置。
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for node := c.freqs.Front(); node != nil; node = node.Next() {
+			for ele := node.Value.(*freqNode).entries.Back(); ele != nil; ele = ele.Prev() {
+				c.evicted(ele.Value.(*entry), lru.EvictCleared)
+			}
+		}
+	}
+	c.usedMem = 0
+	c.freqs = list.New()
+	c.mp = map[string]*list.Element{}
+}
@@ -0,0 +1,91 @@
+package lfu
+
+import (
+	"fmt"
+	"gcache/lru"
+	"testing"
+	"time"
+)
+
+type myValue string
+
+func (v myValue) Len() int {
+	return len(v)
+}
+
+func TestCase1(t *testing.T) {
+	cache := New(30)
+	for i := 0; i < 3; i++ {
+		cache.Add(fmt.Sprintf("hell%d", i), myValue(fmt.Sprintf("worl%d", i)))
+	}
+	//hell0 访问 2 次，hell1 访问 1 次，hell2 没有访问
+	cache.Get("hell0")
+	cache.Get("hell0")
+	cache.Get("hell1")
+
+	cache.Add("hell3", myValue("worl3"))
+	if _, ok := cache.Get("hell2"); ok {
+		t.Error("访问次数最少的 hell2 应该被淘汰")
+	}
+	for _, key := range []string{"hell0", "hell1", "hell3"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("%s 不应该被淘汰", key)
+		}
+	}
+	if cache.Len() != 3 || cache.usedMem != 30 {
+		t.Error("cache.Len err")
+	}
+}
+
+func TestCase2(t *testing.T) {
+	cache := New(30)
+	cache.Add("hell0", myValue("worl0"))
+	cache.Add("hell1", myValue("worl1"))
+	cache.Add("hell2", myValue("worl2"))
+	//访问次数相同时淘汰最久没有访问的 key
+	cache.Get("hell1")
+	cache.Get("hell0")
+	cache.Get("hell2")
+	cache.Add("hell3", myValue("worl3"))
+	if _, ok := cache.mp["hell1"]; ok {
+		t.Error("最久没有访问的 hell1 应该被淘汰")
+	}
+
+	cache.Add("hell0", myValue("WORL0"))
+	val, ok := cache.Get("hell0")
+	if !ok || val.(myValue) != "WORL0" {
+		t.Error("获得的 kv 不是预期的")
+	}
+	if freq := cache.mp["hell0"].Value.(*entry).node.Value.(*freqNode).freq; freq != 4 {
+		t.Errorf("hell0 的访问次数为 %d, 预期 4", freq)
+	}
+}
+
+func TestCase3(t *testing.T) {
+	got := map[string]lru.EvictReason{}
+	cache := New(30)
+	cache.OnEvicted = func(key string, value lru.Value, reason lru.EvictReason) {
+		got[key] = reason
+	}
+	cache.AddWithExpire("hell0", myValue("worl0"), time.Now().Add(-time.Second))
+	cache.Add("hell1", myValue("worl1"))
+	cache.Add("hell2", myValue("worl2"))
+	if n := cache.RemoveExpired(); n != 1 {
+		t.Errorf("RemoveExpired 应该删除 1 个 kv, 实际删除 %d 个", n)
+	}
+	cache.Delete("hell1")
+	cache.Clear()
+	want := map[string]lru.EvictReason{
+		"hell0": lru.EvictExpired,
+		"hell1": lru.EvictDeleted,
+		"hell2": lru.EvictCleared,
+	}
+	for k, reason := range want {
+		if got[k] != reason {
+			t.Errorf("%s 的移除原因为 %v, 预期 %v", k, got[k], reason)
+		}
+	}
+	if cache.Len() != 0 || cache.usedMem != 0 || cache.freqs.Len() != 0 {
+		t.Error("clear err")
+	}
+}
@@ -3,30 +3,123 @@ package lru
 import (
 	"container/list"
 	"time"
+	"unsafe"
 )
 
-var TimeMap map[string]time.Time
+const (
+	// DefaultOldRatio oldList 默认的份额占总容量的比例
+	DefaultOldRatio = 5.0 / 8
+	// DefaultPromoteWindow 默认的晋升时间窗口
+	DefaultPromoteWindow = time.Second
+)
+
+// EvictReason 缓存项被移除的原因
+type EvictReason int
+
+const (
+	// EvictCapacity 容量不足被淘汰
+	EvictCapacity EvictReason = iota
+	// EvictExpired 已过期
+	EvictExpired
+	// EvictDeleted 被显式删除
+	EvictDeleted
+	// EvictReplaced 被同一个key的新值替换
+	EvictReplaced
+	// EvictCleared 缓存被清空
+	EvictCleared
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictDeleted:
+		return "deleted"
+	case EvictReplaced:
+		return "replaced"
+	case EvictCleared:
+		return "cleared"
+	}
+	return "unknown"
+}
+
+// Options 中点插入LRU的配置，参考MySQL的innodb_old_blocks_pct和innodb_old_blocks_time，
+// 零值表示使用默认配置。
+type Options struct {
+	//OldRatio oldList(热点数据)保证可以使用的份额占总容量的比例，取值范围(0, 1)，0表示DefaultOldRatio
+	OldRatio float64
+	//PromoteWindow key加入youngList 超过这个时间后再被访问才会晋升到oldList，0表示DefaultPromoteWindow
+	PromoteWindow time.Duration
+	//DisableWritePromotion 为true时只有Get能触发晋升，Add只更新youngList 中的值
+	DisableWritePromotion bool
+}
+
+// entryOverhead 每个k-v除了key和value之外的额外开销：list.Element、entry和map中的一项
+var entryOverhead = int(unsafe.Sizeof(list.Element{}) + unsafe.Sizeof(entry{}) +
+	unsafe.Sizeof("") + unsafe.Sizeof(uintptr(0)))
+
+// entrySize 返回一个k-v占用的容量
+func entrySize(key string, value Value) int {
+	return len(key) + value.Len() + entryOverhead
+}
 
 // Cache Cache为LRU缓存,并发访问是不安全的。
+// old、young两个链表共用一个总容量：总容量有空余时，任意一个链表都可以超出自己的份额，
+// 总容量不足时，从超出自己份额的链表淘汰，所以每个链表至少可以使用自己的份额。
 type Cache struct {
+	//总容量，0表示不限制
+	maxCap int
 	//缓存热点数据
 	old lruList
 	//缓存新数据
 	young lruList
+	//晋升时间窗口
+	promoteWindow time.Duration
+	//oldList 占总容量的比例
+	oldRatio float64
+	//Add是否可以触发晋升
+	writePromotion bool
+	//young晋升到old的次数
+	promotions int64
+
+	// OnEvicted 可选，缓存项被移除时调用，young、old之间的晋升不算移除
+	OnEvicted func(key string, value Value, reason EvictReason)
 }
 
 type lruList struct {
-	//最大容量
-	maxCap int
+	//保证可以使用的最小容量(份额)
+	minCap int
 	//已经使用了的容量
 	usedMem int
 	ll      *list.List
 	mp      map[string]*list.Element
+	//因为容量不足淘汰、过期、或者值被替换时回调
+	onEvicted func(kv *entry, reason EvictReason)
+}
+
+func newLruList(minCap int, onEvicted func(kv *entry, reason EvictReason)) lruList {
+	return lruList{
+		minCap:    minCap,
+		ll:        list.New(),
+		mp:        map[string]*list.Element{},
+		onEvicted: onEvicted,
+	}
 }
 
 type entry struct {
 	key   string
 	value Value
+	//过期时间，零值表示永不过期
+	expire time.Time
+	//加入youngList 的时间，用于判断是否晋升到oldList
+	addTime time.Time
+}
+
+// expired 判断entry在now时刻是否已经过期
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
 }
 
 // Value 使用Len来计算需要多少字节,lru缓存的value是Value接口类型。
@@ -34,28 +127,62 @@ type Value interface {
 	Len() int
 }
 
-// New 创造一个缓存。
+// New 按默认配置创造一个缓存。
 func New(maxCap int) *Cache {
-	return &Cache{
-		old:   lruList{maxCap: maxCap / 8 * 5, ll: list.New(), mp: map[string]*list.Element{}},
-		young: lruList{maxCap: maxCap / 8 * 3, ll: list.New(), mp: map[string]*list.Element{}},
+	return NewWithOptions(maxCap, Options{})
+}
+
+// NewWithOptions 按opts创造一个缓存，OldRatio不在(0, 1)范围内时panic。
+func NewWithOptions(maxCap int, opts Options) *Cache {
+	ratio := opts.OldRatio
+	if ratio == 0 {
+		ratio = DefaultOldRatio
+	}
+	if ratio <= 0 || ratio >= 1 {
+		panic("lru: OldRatio must be in (0, 1)")
+	}
+	window := opts.PromoteWindow
+	if window <= 0 {
+		window = DefaultPromoteWindow
+	}
+	oldCap := int(float64(maxCap) * ratio)
+	c := &Cache{
+		maxCap:         maxCap,
+		oldRatio:       ratio,
+		promoteWindow:  window,
+		writePromotion: !opts.DisableWritePromotion,
+	}
+	c.old = newLruList(oldCap, c.evicted)
+	c.young = newLruList(maxCap-oldCap, c.evicted)
+	return c
+}
+
+// evicted 回调OnEvicted
+func (c *Cache) evicted(kv *entry, reason EvictReason) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value, reason)
 	}
 }
 
-// Add 添加一个值lruList。
-func (lru *lruList) add(key string, value Value) {
+// promotable 判断youngList 中的entry在now时刻被访问时是否应该晋升到oldList
+func (c *Cache) promotable(e *entry, now time.Time) bool {
+	return e.addTime.Add(c.promoteWindow).Before(now)
+}
+
+// Add 添加一个值lruList，不会淘汰，由Cache统一按总容量淘汰。
+func (lru *lruList) add(key string, value Value, expire time.Time) {
 	if ele, ok := lru.mp[key]; ok {
 		lru.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
 		lru.usedMem += value.Len() - kv.value.Len()
+		replaced := *kv
 		kv.value = value
+		kv.expire = expire
+		lru.onEvicted(&replaced, EvictReplaced)
 	} else {
-		ele := lru.ll.PushFront(&entry{key, value})
+		ele := lru.ll.PushFront(&entry{key: key, value: value, expire: expire, addTime: time.Now()})
 		lru.mp[key] = ele
-		lru.usedMem += len(key) + value.Len()
-	}
-	for lru.maxCap != 0 && lru.maxCap < lru.usedMem {
-		lru.removeTail()
+		lru.usedMem += entrySize(key, value)
 	}
 }
 
@@ -66,7 +193,8 @@ func (lru *lruList) removeTail() {
 		lru.ll.Remove(ele)
 		kv := ele.Value.(*entry)
 		delete(lru.mp, kv.key)
-		lru.usedMem -= len(kv.key) + kv.value.Len()
+		lru.usedMem -= entrySize(kv.key, kv.value)
+		lru.onEvicted(kv, EvictCapacity)
 	}
 }
 
@@ -84,58 +212,156 @@ func (lru *lruList) delete(key string) bool {
 	val := ele.Value.(*entry)
 	lru.ll.Remove(ele)
 	delete(lru.mp, key)
-	lru.usedMem -= len(val.key) + val.value.Len()
+	lru.usedMem -= entrySize(val.key, val.value)
 	return true
 }
 
+// removeExpired 删除lruList中所有已过期的k-v，返回删除的个数
+func (lru *lruList) removeExpired(now time.Time) int {
+	n := 0
+	for ele := lru.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if kv := ele.Value.(*entry); kv.expired(now) {
+			lru.delete(kv.key)
+			lru.onEvicted(kv, EvictExpired)
+			n++
+		}
+		ele = prev
+	}
+	return n
+}
+
+// Add 添加一个永不过期的值。
 func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 添加一个值，expire为过期时间，零值表示永不过期。
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	c.add(key, value, expire)
+	for c.overflow() {
+		c.removeVictim()
+	}
+}
+
+func (c *Cache) add(key string, value Value, expire time.Time) {
 	if _, ok := c.old.mp[key]; ok {
-		c.old.add(key, value)
+		c.old.add(key, value, expire)
 		return
 	}
 	if ele, ok := c.young.mp[key]; ok {
-
-		addTime := TimeMap[key]
-		if ok := addTime.Add(time.Second).Before(time.Now()); ok {
-			//如果加入youngList 一秒钟之后又被访问，就加入olsList
+		val := ele.Value.(*entry)
+		if c.writePromotion && c.promotable(val, time.Now()) {
+			//如果加入youngList 超过晋升窗口之后又被访问，就加入olsList
 			//加入oldList
-			val := ele.Value.(*entry)
-			c.old.add(key, value)
-			//删除youngList
+			c.old.add(key, value, expire)
+			c.promotions++
+			//删除youngList，旧值视为被替换
 			c.young.delete(val.key)
-			delete(TimeMap, key)
+			c.evicted(val, EvictReplaced)
 			return
 		} else {
-			//如果加入youngList 一秒钟之内又被访问，只在youngList 变化位置，加入youngList 头部
-			c.young.add(key, value)
+			//如果加入youngList 晋升窗口之内又被访问(或者Add不能触发晋升)，只在youngList 变化位置，加入youngList 头部
+			c.young.add(key, value, expire)
 			c.young.ll.MoveToFront(ele)
 			return
 		}
 	}
 
-	TimeMap[key] = time.Now()
-	c.young.add(key, value)
+	c.young.add(key, value, expire)
+}
 
+// overflow 判断是否超出总容量
+func (c *Cache) overflow() bool {
+	return c.maxCap != 0 && c.maxCap < c.young.usedMem+c.old.usedMem
 }
 
-// Get 查找的key的值。
+// victimList 返回youngList 再使用youngExtra容量之后，应该从哪个链表淘汰：
+// youngList 超出自己的份额时从youngList 淘汰，否则从借用了youngList 份额的oldList淘汰。
+func (c *Cache) victimList(youngExtra int) *lruList {
+	if c.young.usedMem+youngExtra > c.young.minCap && c.young.ll.Len() > 0 || c.old.ll.Len() == 0 {
+		return &c.young
+	}
+	return &c.old
+}
+
+// removeVictim 总容量不足时淘汰一个k-v
+func (c *Cache) removeVictim() {
+	c.victimList(0).removeTail()
+}
+
+// Victim 返回加入key之后最先被淘汰的key：新key加入youngList，总容量不足时从超出份额的链表尾部淘汰。
+// key已经存在或者加入key不需要淘汰时ok为false。
+func (c *Cache) Victim(key string, value Value) (victim string, ok bool) {
+	if _, ok := c.old.mp[key]; ok {
+		return "", false
+	}
+	if _, ok := c.young.mp[key]; ok {
+		return "", false
+	}
+	size := entrySize(key, value)
+	if c.maxCap == 0 || c.young.usedMem+c.old.usedMem+size <= c.maxCap {
+		return "", false
+	}
+	if ele := c.victimList(size).ll.Back(); ele != nil {
+		return ele.Value.(*entry).key, true
+	}
+	return "", false
+}
+
+// lookup 在old、young两个链表中查找key，返回所在的链表
+func (c *Cache) lookup(key string) (*entry, *lruList) {
+	if ele, ok := c.old.mp[key]; ok {
+		return ele.Value.(*entry), &c.old
+	}
+	if ele, ok := c.young.mp[key]; ok {
+		return ele.Value.(*entry), &c.young
+	}
+	return nil, nil
+}
+
+// Peek 查找key的值，不会移动或者晋升key，也不会删除已过期的key，已过期的key视为不存在。
+func (c *Cache) Peek(key string) (value Value, ok bool) {
+	kv, _ := c.lookup(key)
+	if kv == nil || kv.expired(time.Now()) {
+		return nil, false
+	}
+	return kv.value, true
+}
+
+// Contains 判断key是否存在且未过期，和Peek一样不影响淘汰顺序。
+func (c *Cache) Contains(key string) bool {
+	_, ok := c.Peek(key)
+	return ok
+}
+
+// Get 查找的key的值，已过期的key会被删除并视为不存在。
 func (c *Cache) Get(key string) (value Value, ok bool) {
 	if ele, ok := c.old.mp[key]; ok {
 		val := ele.Value.(*entry)
+		if val.expired(time.Now()) {
+			c.old.delete(key)
+			c.evicted(val, EvictExpired)
+			return nil, false
+		}
 		c.old.ll.MoveToFront(ele)
 		return val.value, true
 	}
 
 	if ele, ok := c.young.mp[key]; ok {
-		addTime := TimeMap[key]
 		val := ele.Value.(*entry)
-		if ok := addTime.Add(time.Second).Before(time.Now()); ok {
-			//如果加入youngList 一秒钟之后又被访问，就加入olsList
+		if val.expired(time.Now()) {
+			c.young.delete(key)
+			c.evicted(val, EvictExpired)
+			return nil, false
+		}
+		if c.promotable(val, time.Now()) {
+			//如果加入youngList 超过晋升窗口之后又被访问，就加入olsList
 			//加入oldList
-			c.old.add(val.key, val.value)
+			c.old.add(val.key, val.value, val.expire)
+			c.promotions++
 			//删除youngList
 			c.young.delete(val.key)
-			delete(TimeMap, key)
 		}
 		return val.value, true
 	}
@@ -143,17 +369,41 @@ func (c *Cache) Get(key string) (value Value, ok bool) {
 	return nil, false
 }
 
+// Delete 删除某key
 func (c *Cache) Delete(key string) bool {
-	if _, ok := c.old.mp[key]; ok {
-		return c.old.delete(key)
+	ele, ok := c.old.mp[key]
+	if ok {
+		c.old.delete(key)
+	} else if ele, ok = c.young.mp[key]; ok {
+		c.young.delete(key)
+	} else {
+		return false
 	}
+	c.evicted(ele.Value.(*entry), EvictDeleted)
+	return true
+}
 
-	if _, ok := c.young.mp[key]; ok {
-		delete(TimeMap, key)
-		return c.young.delete(key)
-	}
+// RemoveExpired 删除young、old两个链表中所有已过期的k-v，返回删除的个数。
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	return c.young.removeExpired(now) + c.old.removeExpired(now)
+}
 
-	return false
+// Resize 修改总容量，并按OldRatio重新分配old、young两个链表的份额。
+// 不会立即淘汰，超出的部分由Trim或者之后的Add淘汰。
+func (c *Cache) Resize(maxCap int) {
+	oldCap := int(float64(maxCap) * c.oldRatio)
+	c.maxCap = maxCap
+	c.old.minCap = oldCap
+	c.young.minCap = maxCap - oldCap
+}
+
+// Trim 超出容量时最多淘汰n个k-v，返回是否已经不超出容量。
+func (c *Cache) Trim(n int) bool {
+	for ; n > 0 && c.overflow(); n-- {
+		c.removeVictim()
+	}
+	return !c.overflow()
 }
 
 // Len 返回缓存k-v的个数。
@@ -161,18 +411,110 @@ func (c *Cache) Len() int {
 	return c.young.Len() + c.old.Len()
 }
 
-func (c *Cache) Clear() {
-	c.old = lruList{
-		ll: list.New(),
-		mp: map[string]*list.Element{},
+// Entry 缓存项的快照
+type Entry struct {
+	Key    string
+	Value  Value
+	Expire time.Time
+	//List 缓存项所在的链表
+	List string
+}
+
+// walk 按从最久没访问到最近访问的顺序遍历lruList中未过期的缓存项，fn返回false时停止并返回false
+func (lru *lruList) walk(name string, now time.Time, fn func(e Entry) bool) bool {
+	for ele := lru.ll.Back(); ele != nil; ele = ele.Prev() {
+		if kv := ele.Value.(*entry); !kv.expired(now) {
+			if !fn(Entry{Key: kv.key, Value: kv.value, Expire: kv.expire, List: name}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Range 先young后old遍历所有未过期的缓存项，每个链表内按从最久没访问到最近访问的顺序，Entry.List为所在的链表。
+// fn返回false时停止遍历。Range不会影响淘汰顺序，fn中不能修改缓存。
+func (c *Cache) Range(fn func(e Entry) bool) {
+	now := time.Now()
+	if c.young.walk("young", now, fn) {
+		c.old.walk("old", now, fn)
+	}
+}
+
+// Keys 按Range的顺序返回所有未过期的key。
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	c.Range(func(e Entry) bool {
+		keys = append(keys, e.Key)
+		return true
+	})
+	return keys
+}
+
+// Snapshot 返回所有未过期的缓存项，每个链表内按从最久没访问到最近访问的顺序。
+func (c *Cache) Snapshot() []Entry {
+	entries := make([]Entry, 0, c.Len())
+	c.Range(func(e Entry) bool {
+		entries = append(entries, e)
+		return true
+	})
+	return entries
+}
+
+// Restore 把快照中的缓存项加入到它原来所在链表的头部，不会触发晋升；按Snapshot的顺序Restore可以还原访问顺序。
+func (c *Cache) Restore(e Entry) {
+	c.old.delete(e.Key)
+	c.young.delete(e.Key)
+	if e.List == "old" {
+		c.old.add(e.Key, e.Value, e.Expire)
+	} else {
+		c.young.add(e.Key, e.Value, e.Expire)
 	}
-	c.young = lruList{
-		ll: list.New(),
-		mp: map[string]*list.Element{},
+	for c.overflow() {
+		c.removeVictim()
 	}
-	TimeMap = make(map[string]time.Time)
 }
 
-func init() {
-	TimeMap = make(map[string]time.Time)
+// ListStats 一个链表的统计信息
+type ListStats struct {
+	Name  string
+	Bytes int64
+	Items int64
+}
+
+// Stats 缓存的统计信息
+type Stats struct {
+	//Promotions 晋升到热点链表的次数
+	Promotions int64
+	//Bytes、Items 缓存已经使用的容量和k-v的个数
+	Bytes int64
+	Items int64
+	//Lists 每个链表的统计信息
+	Lists []ListStats
+}
+
+// Stats 返回young、old两个链表的统计信息。
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Promotions: c.promotions,
+		Bytes:      int64(c.young.usedMem + c.old.usedMem),
+		Items:      int64(c.Len()),
+		Lists: []ListStats{
+			{Name: "young", Bytes: int64(c.young.usedMem), Items: int64(c.young.Len())},
+			{Name: "old", Bytes: int64(c.old.usedMem), Items: int64(c.old.Len())},
+		},
+	}
+}
+
+// Clear 清空缓存，保留容量设置。
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for _, l := range []*lruList{&c.old, &c.young} {
+			for ele := l.ll.Back(); ele != nil; ele = ele.Prev() {
+				c.evicted(ele.Value.(*entry), EvictCleared)
+			}
+		}
+	}
+	c.old = newLruList(c.old.minCap, c.evicted)
+	c.young = newLruList(c.young.minCap, c.evicted)
 }
@@ -8,13 +8,16 @@ import (
 
 type myValue string
 
+// kvSize 测试中每个 kv 的 key、value 都是 5 个字节
+var kvSize = 10 + entryOverhead
+
 func (v myValue) Len() int {
 	return len(v)
 }
 
 func TestCase1(t *testing.T) {
-	cache := New(80)
-	if cache.young.maxCap != 30 || cache.old.maxCap != 50 {
+	cache := New(8 * kvSize)
+	if cache.young.minCap != 3*kvSize || cache.old.minCap != 5*kvSize {
 		t.Error("old、young 内存分配错误")
 	}
 	cache.Add("hello", myValue("world"))
@@ -31,7 +34,7 @@ func TestCase1(t *testing.T) {
 		t.Error("获得的 kv 不是预期的")
 	}
 
-	if cache.young.Len() != 1 || cache.young.usedMem != 10 {
+	if cache.young.Len() != 1 || cache.young.usedMem != kvSize {
 		t.Error("kv 没有分配到 young list")
 	}
 	if cache.old.Len() != 0 || cache.old.usedMem != 0 {
@@ -43,7 +46,7 @@ func TestCase1(t *testing.T) {
 }
 
 func TestCase2(t *testing.T) {
-	cache := New(80)
+	cache := New(8 * kvSize)
 	cache.Add("hello", myValue("world"))
 	//sleep second
 	time.Sleep(time.Second)
@@ -72,20 +75,18 @@ func TestCase2(t *testing.T) {
 		t.Error("获得的 kv 不是预期的")
 	}
 
-	if cache.old.Len() != 2 || cache.old.usedMem != 20 {
+	if cache.old.Len() != 2 || cache.old.usedMem != 2*kvSize {
 		t.Error("kc 没有分配到 old list")
 	}
 
 	if cache.young.Len() != 0 || cache.young.usedMem != 0 {
 		t.Error("young list 不应该分配kv")
 	}
-	if len(TimeMap) != 0 {
-		t.Error("TimeMap 没有删除")
-	}
 }
 
 func TestCase3(t *testing.T) {
-	cache := New(80)
+	//总容量只能放下 3 个 kv
+	cache := New(3 * kvSize)
 
 	for i := 0; i <= 3; i++ {
 		cache.Add(fmt.Sprintf("hell%d", i), myValue(fmt.Sprintf("worl%d", i)))
@@ -99,7 +100,7 @@ func TestCase3(t *testing.T) {
 			t.Error("获得的 kv 不是预期的")
 		}
 	}
-	if cache.young.Len() != 3 || cache.young.usedMem != 30 {
+	if cache.young.Len() != 3 || cache.young.usedMem != 3*kvSize {
 		t.Error("kv 没有全部分配到 young list")
 	}
 	if cache.old.Len() != 0 || cache.old.usedMem != 0 {
@@ -108,7 +109,8 @@ func TestCase3(t *testing.T) {
 }
 
 func TestCase4(t *testing.T) {
-	cache := New(80)
+	//总容量只能放下 3 个 kv
+	cache := New(3 * kvSize)
 
 	for i := 0; i <= 3; i++ {
 		cache.Add(fmt.Sprintf("hell%d", i), myValue(fmt.Sprintf("worl%d", i)))
@@ -127,18 +129,18 @@ func TestCase4(t *testing.T) {
 	if cache.young.Len() != 0 || cache.young.usedMem != 0 {
 		t.Error("kv 应该迁移到 old list 了")
 	}
-	if cache.old.Len() != 3 || cache.old.usedMem != 30 {
+	if cache.old.Len() != 3 || cache.old.usedMem != 3*kvSize {
 		t.Error("kv 应该迁移到 old list 了")
 	}
 }
 
 func TestCase5(t *testing.T) {
-	cache := New(80)
+	cache := New(8 * kvSize)
 	cache.Add("hell1", myValue("worl1"))
 	cache.Add("hell2", myValue("worl2"))
 	cache.Add("hell3", myValue("worl3"))
 	cache.Delete("hell1")
-	if cache.young.Len() != 2 || cache.young.usedMem != 20 {
+	if cache.young.Len() != 2 || cache.young.usedMem != 2*kvSize {
 		t.Error("kv 没有全部分配到 young list")
 	}
 	if cache.old.Len() != 0 || cache.old.usedMem != 0 {
@@ -152,7 +154,303 @@ func TestCase5(t *testing.T) {
 	if cache.old.Len() != 0 || cache.old.usedMem != 0 {
 		t.Error("clear err")
 	}
-	if len(TimeMap) != 0 {
-		t.Error("clear err")
+	cache.Add("hell1", myValue("worl1"))
+	if cache.young.Len() != 1 || cache.young.usedMem != kvSize || cache.young.minCap != 3*kvSize {
+		t.Error("clear 之后应该保留容量设置")
+	}
+}
+
+func TestExpireCase1(t *testing.T) {
+	cache := New(8 * kvSize)
+	cache.AddWithExpire("hell1", myValue("worl1"), time.Now().Add(100*time.Millisecond))
+	cache.Add("hell2", myValue("worl2"))
+	if _, ok := cache.Get("hell1"); !ok {
+		t.Error("未过期的 kv 应该能获取到")
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if _, ok := cache.Get("hell1"); ok {
+		t.Error("过期的 kv 不应该能获取到")
+	}
+	if _, ok := cache.Get("hell2"); !ok {
+		t.Error("没有过期时间的 kv 应该能获取到")
+	}
+	if cache.Len() != 1 || cache.young.usedMem != kvSize {
+		t.Error("过期的 kv 没有被删除")
+	}
+}
+
+func TestExpireCase2(t *testing.T) {
+	cache := New(8 * kvSize)
+	expire := time.Now().Add(1500 * time.Millisecond)
+	cache.AddWithExpire("hell1", myValue("worl1"), expire)
+	cache.AddWithExpire("hell2", myValue("worl2"), expire)
+	cache.AddWithExpire("hell3", myValue("worl3"), time.Now().Add(time.Hour))
+	time.Sleep(time.Second)
+	//hell1 晋升到 old list
+	cache.Get("hell1")
+	if cache.old.Len() != 1 || cache.young.Len() != 2 {
+		t.Error("kv 应该迁移到 old list 了")
+	}
+
+	time.Sleep(time.Second)
+	if n := cache.RemoveExpired(); n != 2 {
+		t.Errorf("RemoveExpired 应该删除 2 个 kv, 实际删除 %d 个", n)
+	}
+	if cache.old.Len() != 0 || cache.old.usedMem != 0 {
+		t.Error("old list 的过期 kv 没有被删除")
+	}
+	if cache.young.Len() != 1 || cache.young.usedMem != kvSize {
+		t.Error("young list 的过期 kv 没有被删除")
+	}
+}
+
+func TestMultiCache(t *testing.T) {
+	c1, c2 := New(8*kvSize), New(8*kvSize)
+	c1.Add("hello", myValue("world"))
+	time.Sleep(time.Second)
+	//c2 中的同名 key 刚加入 young list，不应该受 c1 的加入时间影响
+	c2.Add("hello", myValue("world"))
+	c2.Get("hello")
+	if c2.old.Len() != 0 || c2.young.Len() != 1 {
+		t.Error("c2 的 kv 不应该晋升到 old list")
+	}
+	c1.Get("hello")
+	if c1.old.Len() != 1 || c1.young.Len() != 0 {
+		t.Error("c1 的 kv 应该晋升到 old list")
+	}
+
+	//c1 的 Clear 不应该影响 c2
+	c1.Clear()
+	time.Sleep(time.Second)
+	c2.Get("hello")
+	if c2.old.Len() != 1 || c2.young.Len() != 0 {
+		t.Error("c2 的 kv 应该晋升到 old list")
+	}
+}
+
+func TestMultiCacheConcurrent(t *testing.T) {
+	caches := make([]*Cache, 8)
+	for i := range caches {
+		caches[i] = New(1 << 10)
+	}
+	done := make(chan struct{})
+	for _, cache := range caches {
+		go func(cache *Cache) {
+			defer func() { done <- struct{}{} }()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("hell%d", i%10)
+				cache.Add(key, myValue("world"))
+				cache.Get(key)
+				if i%7 == 0 {
+					cache.Delete(key)
+				}
+			}
+		}(cache)
+	}
+	for range caches {
+		<-done
+	}
+	for _, cache := range caches {
+		if cache.Len() == 0 || cache.Len() > 10 {
+			t.Errorf("cache.Len() = %d, 不是预期的", cache.Len())
+		}
+	}
+}
+
+func TestOptionsCase1(t *testing.T) {
+	cache := NewWithOptions(10*kvSize, Options{OldRatio: 0.4, PromoteWindow: 100 * time.Millisecond})
+	if oldCap := int(float64(10*kvSize) * 0.4); cache.old.minCap != oldCap || cache.young.minCap != 10*kvSize-oldCap {
+		t.Error("old、young 内存分配错误")
+	}
+	cache.Add("hello", myValue("world"))
+	cache.Get("hello")
+	if cache.old.Len() != 0 {
+		t.Error("晋升窗口之内不应该晋升")
+	}
+	time.Sleep(200 * time.Millisecond)
+	cache.Get("hello")
+	if cache.old.Len() != 1 || cache.young.Len() != 0 {
+		t.Error("超过晋升窗口应该晋升到 old list")
+	}
+}
+
+func TestOptionsCase2(t *testing.T) {
+	cache := NewWithOptions(8*kvSize, Options{PromoteWindow: 100 * time.Millisecond, DisableWritePromotion: true})
+	cache.Add("hello", myValue("world"))
+	time.Sleep(200 * time.Millisecond)
+	cache.Add("hello", myValue("WORLD"))
+	if cache.old.Len() != 0 || cache.young.Len() != 1 {
+		t.Error("Add 不应该触发晋升")
+	}
+	val, ok := cache.Get("hello")
+	if !ok || val.(myValue) != "WORLD" {
+		t.Error("获得的 kv 不是预期的")
+	}
+	if cache.old.Len() != 1 || cache.young.Len() != 0 {
+		t.Error("Get 应该触发晋升")
+	}
+}
+
+func TestOptionsCase3(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("OldRatio 不合法应该 panic")
+		}
+	}()
+	NewWithOptions(8*kvSize, Options{OldRatio: 1})
+}
+
+func TestOnEvicted(t *testing.T) {
+	got := map[string]EvictReason{}
+	cache := NewWithOptions(3*kvSize, Options{PromoteWindow: 100 * time.Millisecond})
+	cache.OnEvicted = func(key string, value Value, reason EvictReason) {
+		got[key+"="+string(value.(myValue))] = reason
+	}
+
+	//总容量只能放下 3 个 kv，加入第 4 个 kv 时淘汰 hell0
+	for i := 0; i <= 3; i++ {
+		cache.Add(fmt.Sprintf("hell%d", i), myValue(fmt.Sprintf("worl%d", i)))
+	}
+	cache.Add("hell1", myValue("WORL1"))
+	cache.Delete("hell2")
+	cache.AddWithExpire("hell4", myValue("worl4"), time.Now().Add(-time.Second))
+	cache.Get("hell4")
+	time.Sleep(200 * time.Millisecond)
+	//晋升到 old list 不算移除
+	cache.Get("hell3")
+	cache.Clear()
+
+	want := map[string]EvictReason{
+		"hell0=worl0": EvictCapacity,
+		"hell1=worl1": EvictReplaced,
+		"hell2=worl2": EvictDeleted,
+		"hell4=worl4": EvictExpired,
+		"hell1=WORL1": EvictCleared,
+		"hell3=worl3": EvictCleared,
+	}
+	if len(got) != len(want) {
+		t.Errorf("OnEvicted 调用了 %d 次, 预期 %d 次: %v", len(got), len(want), got)
+	}
+	for k, reason := range want {
+		if got[k] != reason {
+			t.Errorf("%s 的移除原因为 %v, 预期 %v", k, got[k], reason)
+		}
+	}
+}
+
+func TestVictim(t *testing.T) {
+	cache := New(3 * kvSize)
+	cache.Add("hell0", myValue("worl0"))
+	cache.Add("hell1", myValue("worl1"))
+	if _, ok := cache.Victim("hell2", myValue("worl2")); ok {
+		t.Error("总容量足够时不需要淘汰")
+	}
+	cache.Add("hell2", myValue("worl2"))
+	if victim, ok := cache.Victim("hell3", myValue("worl3")); !ok || victim != "hell0" {
+		t.Errorf("victim = %s, 预期 hell0", victim)
+	}
+	if _, ok := cache.Victim("hell1", myValue("WORL1")); ok {
+		t.Error("已经存在的 key 不需要淘汰")
+	}
+}
+
+func TestResize(t *testing.T) {
+	cache := New(8 * kvSize)
+	for i := 0; i < 3; i++ {
+		cache.Add(fmt.Sprintf("hell%d", i), myValue(fmt.Sprintf("worl%d", i)))
+	}
+	cache.Resize(16 * kvSize)
+	if cache.old.minCap != 10*kvSize || cache.young.minCap != 6*kvSize {
+		t.Error("old、young 内存分配错误")
+	}
+	if !cache.Trim(1) {
+		t.Error("扩容之后不应该超出容量")
+	}
+
+	cache.Resize(16)
+	if cache.Trim(1) || cache.young.Len() != 2 {
+		t.Error("每次 Trim 最多淘汰 1 个 kv")
+	}
+	if !cache.Trim(10) || cache.young.Len() != 0 {
+		t.Error("Trim 之后不应该超出容量")
+	}
+}
+
+func TestBudget(t *testing.T) {
+	cache := NewWithOptions(8*kvSize, Options{PromoteWindow: 50 * time.Millisecond})
+	for i := 0; i < 8; i++ {
+		cache.Add(fmt.Sprintf("hell%d", i), myValue(fmt.Sprintf("worl%d", i)))
+	}
+	if cache.young.Len() != 8 {
+		t.Error("old list 没有使用时，young list 可以借用它的份额")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	cache.Get("hell0")
+	cache.Get("hell1")
+	//young list 超出了自己的份额，从 young list 淘汰
+	cache.Add("hell8", myValue("worl8"))
+	if _, ok := cache.young.mp["hell2"]; ok || cache.old.Len() != 2 || cache.young.Len() != 6 {
+		t.Error("应该淘汰 young list 的尾部 hell2")
+	}
+
+	for i := 3; i < 8; i++ {
+		cache.Get(fmt.Sprintf("hell%d", i))
+	}
+	//old list 超出了自己的份额，young list 至少可以使用自己的份额
+	cache.Add("hell9", myValue("worl9"))
+	if _, ok := cache.old.mp["hell0"]; ok || cache.old.Len() != 6 || cache.young.Len() != 2 {
+		t.Error("应该淘汰 old list 的尾部 hell0")
+	}
+	if cache.young.usedMem+cache.old.usedMem > 8*kvSize {
+		t.Error("超出总容量")
+	}
+}
+
+func TestEntryOverhead(t *testing.T) {
+	//maxCap 小于一个 kv 的额外开销时，不能缓存任何 kv
+	cache := New(entryOverhead)
+	cache.Add("hello", myValue("world"))
+	if cache.Len() != 0 {
+		t.Error("kv 的额外开销应该计入容量")
+	}
+}
+
+func TestPeekRange(t *testing.T) {
+	cache := NewWithOptions(8*kvSize, Options{PromoteWindow: 50 * time.Millisecond})
+	cache.Add("hell0", myValue("worl0"))
+	cache.Add("hell1", myValue("worl1"))
+	cache.AddWithExpire("hell2", myValue("worl2"), time.Now().Add(50*time.Millisecond))
+	time.Sleep(100 * time.Millisecond)
+	if v, ok := cache.Peek("hell0"); !ok || v.(myValue) != "worl0" {
+		t.Error("Peek 获得的 kv 不是预期的")
+	}
+	//超过晋升窗口，Peek 也不应该晋升
+	if cache.old.Len() != 0 {
+		t.Error("Peek 不应该触发晋升")
+	}
+	if cache.Contains("hell2") || cache.young.Len() != 3 {
+		t.Error("Peek 应该把已过期的 key 视为不存在，但不删除")
+	}
+	cache.Get("hell1")
+	if keys := cache.Keys(); fmt.Sprint(keys) != "[hell0 hell1]" {
+		t.Errorf("Keys = %v", keys)
+	}
+	var lists []string
+	cache.Range(func(e Entry) bool {
+		lists = append(lists, e.Key+":"+e.List)
+		return true
+	})
+	if fmt.Sprint(lists) != "[hell0:young hell1:old]" {
+		t.Errorf("Range = %v", lists)
+	}
+	n := 0
+	cache.Range(func(e Entry) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Error("fn 返回 false 时应该停止遍历")
 	}
 }
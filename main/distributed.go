@@ -16,7 +16,7 @@ func creatCache(cacheCap int, getter gcache.Getter) *gcache.GCache {
 				if v, ok := db[key]; ok {
 					return []byte(v), nil
 				}
-				return nil, fmt.Errorf("%s not exist", key)
+				return nil, fmt.Errorf("%s not exist: %w", key, gcache.ErrNotFound)
 			}))
 	}
 	return gcache.NewCache(cacheCap, getter)
@@ -36,7 +36,7 @@ func startAPIServer(apiAddr string, cache *gcache.GCache) {
 			key := r.URL.Query().Get("key")
 			view, err := cache.Get(key)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				http.Error(w, err.Error(), gcache.StatusCode(err))
 				return
 			}
 			w.Header().Set("Content-Type", "application/octet-stream")
@@ -65,7 +65,7 @@ func distributed() {
 		addrs = append(addrs, v)
 	}
 
-	cache := creatCache(1<<5, nil)
+	cache := creatCache(1<<10, nil)
 	go startAPIServer(apiAddr, cache)
 	startCacheServer(addrMap[port], addrs, cache)
 }
@@ -16,13 +16,13 @@ var db = map[string]string{
 }
 
 func simple() {
-	gc := gcache.NewCache(1<<5, gcache.GetterFunc(
+	gc := gcache.NewCache(1<<10, gcache.GetterFunc(
 		func(key string) ([]byte, error) {
 			log.Println("[SlowDB] search key", key)
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
+			return nil, fmt.Errorf("%s not exist: %w", key, gcache.ErrNotFound)
 		}))
 	selfUrl := gcache.NewHTTPPool("127.0.0.1:8081")
 	selfUrl.AddPeers("127.0.0.1:8081")
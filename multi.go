@@ -0,0 +1,248 @@
+package gcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// BatchGetter Getter可以同时实现这个接口，GetMulti中属于自己、没有命中的key只调用一次GetMulti加载；
+// 返回的map中没有的key视为不存在，返回的错误作为所有key的错误
+type BatchGetter interface {
+	GetMulti(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+
+// MultiError GetMulti中加载失败的key和对应的错误，不包含不存在的key
+type MultiError map[string]error
+
+func (e MultiError) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) == 1 {
+		return e[keys[0]].Error()
+	}
+	return fmt.Sprintf("gcache: %d keys failed, first: %v", len(keys), e[keys[0]])
+}
+
+// GetMulti 一次获取多个key，见GetMultiContext
+func (c *GCache) GetMulti(keys []string) (map[string]ByteView, error) {
+	return c.GetMultiContext(context.Background(), keys)
+}
+
+// GetMultiContext 一次获取多个key，返回命中和加载成功的值，不存在的key不在返回的map中，其他失败的key在MultiError中。
+// 没有命中的key按所有者分组，每个peer只发一次请求；属于自己的key和从peer加载失败的key在Getter实现了BatchGetter时只调用一次GetMulti。
+// 每个key仍然经过singleflight合并，和同时进行的Get共享加载结果。有没有命中的key而ctx已经结束时返回ctx.Err()。
+func (c *GCache) GetMultiContext(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	values := make(map[string]ByteView, len(keys))
+	errs := MultiError{}
+	seen := make(map[string]bool, len(keys))
+	var misses []string
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if key == "" {
+			errs[key] = ErrKeyRequired
+			continue
+		}
+		//lookupCache只会返回负缓存的ErrNotFound
+		if v, ok, err := c.lookupCache(key); ok {
+			values[key] = v
+		} else if err == nil {
+			misses = append(misses, key)
+		}
+	}
+
+	if len(misses) > 0 {
+		if err := ctx.Err(); err != nil {
+			return values, err
+		}
+		c.loadMulti(ctx, misses, values, errs)
+	}
+	if len(errs) == 0 {
+		return values, nil
+	}
+	return values, errs
+}
+
+// loadMulti 通过Loader.DoMulti加载misses，结果写入values和errs
+func (c *GCache) loadMulti(ctx context.Context, misses []string, values map[string]ByteView, errs MultiError) {
+	vals, loadErrs, shared := c.Loader.DoMulti(ctx, misses, c.getMulti)
+	c.stats.dedupLoads.Add(int64(len(shared)))
+	for key, v := range vals {
+		values[key] = v
+	}
+	for key, err := range loadErrs {
+		if !errors.Is(err, ErrNotFound) {
+			errs[key] = err
+		}
+	}
+}
+
+// getMulti 按所有者分组并行加载keys，每个peer只发一次请求；
+// 属于自己的key和从peer加载失败的key合在一起，在所有peer返回之后只在本地加载一次
+func (c *GCache) getMulti(ctx context.Context, keys []string) (map[string]ByteView, map[string]error) {
+	type batch struct {
+		peer PeerGetter
+		keys []string
+	}
+	batches := map[string]*batch{}
+	var local []string
+	for _, key := range keys {
+		if c.Peers != nil {
+			if peer, ok := c.Peers.PickPeer(key); ok {
+				name := peerName(peer)
+				b, ok := batches[name]
+				if !ok {
+					b = &batch{peer: peer}
+					batches[name] = b
+				}
+				b.keys = append(b.keys, key)
+				continue
+			}
+		}
+		local = append(local, key)
+	}
+
+	values := make(map[string]ByteView, len(keys))
+	errs := make(map[string]error)
+	merge := func(vals map[string]ByteView, loadErrs map[string]error) {
+		for key, v := range vals {
+			values[key] = v
+		}
+		for key, err := range loadErrs {
+			errs[key] = err
+		}
+	}
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		panicked interface{}
+	)
+	for _, b := range batches {
+		wg.Add(1)
+		go func(b *batch) {
+			defer wg.Done()
+			//PeerGetter panic时交给Loader所在的goroutine，由它通知等待的调用方
+			defer func() {
+				if r := recover(); r != nil {
+					mu.Lock()
+					panicked = r
+					mu.Unlock()
+				}
+			}()
+			vals, peerErrs, fallback := c.getMultiFromPeer(ctx, b.peer, b.keys)
+			mu.Lock()
+			defer mu.Unlock()
+			merge(vals, peerErrs)
+			local = append(local, fallback...)
+		}(b)
+	}
+	wg.Wait()
+	if panicked != nil {
+		panic(panicked)
+	}
+	if len(local) > 0 {
+		merge(c.getMultiLocally(ctx, local))
+	}
+	return values, errs
+}
+
+// getMultiFromPeer 从peer获取keys，peer实现了BatchPeerGetter时只发一次请求；
+// 和load一样，peer返回的不存在是确定的，其他错误在ctx没有结束时作为fallback返回，由调用方从本地加载
+func (c *GCache) getMultiFromPeer(ctx context.Context, peer PeerGetter, keys []string) (values map[string]ByteView, errs map[string]error, fallback []string) {
+	values = make(map[string]ByteView, len(keys))
+	errs = make(map[string]error)
+	result := func(key string, value ByteView, err error) {
+		if err == nil {
+			c.stats.peerLoads.Add(1)
+			c.maybeCacheHot(key, value)
+			values[key] = value
+			return
+		}
+		if errors.Is(err, ErrNotFound) {
+			c.rememberNotFound(key)
+			errs[key] = err
+			return
+		}
+		c.stats.peerErrors.Add(1)
+		if ctx.Err() != nil {
+			errs[key] = err
+		} else {
+			fallback = append(fallback, key)
+		}
+	}
+
+	if g, ok := peer.(BatchPeerGetter); ok {
+		vals, peerErrs, err := g.GetMulti(ctx, keys)
+		for _, key := range keys {
+			if err != nil {
+				result(key, ByteView{}, keyedError(ErrPeerUnavailable, key, err))
+			} else if e, ok := peerErrs[key]; ok {
+				result(key, ByteView{}, wrapError(ErrPeerUnavailable, key, e))
+			} else if v, ok := vals[key]; ok {
+				result(key, ByteView{b: v}, nil)
+			} else {
+				result(key, ByteView{}, &Error{Kind: ErrNotFound, Key: key})
+			}
+		}
+	} else {
+		for _, key := range keys {
+			v, err := c.getFromPeer(ctx, peer, key)
+			result(key, v, err)
+		}
+	}
+	if len(fallback) > 0 {
+		log.Printf("[gcache] load %d keys from peer %s failed, loading locally\n", len(fallback), peerName(peer))
+	}
+	return values, errs, fallback
+}
+
+// getMultiLocally 通过Getter加载keys，Getter实现了BatchGetter时只调用一次GetMulti，否则逐个调用getLocally
+func (c *GCache) getMultiLocally(ctx context.Context, keys []string) (map[string]ByteView, map[string]error) {
+	values := make(map[string]ByteView, len(keys))
+	errs := make(map[string]error)
+	g, ok := c.Getter.(BatchGetter)
+	if !ok {
+		for _, key := range keys {
+			v, err := c.getLocally(ctx, key)
+			if err != nil {
+				c.stats.localLoadErrs.Add(1)
+				errs[key] = err
+				continue
+			}
+			c.stats.localLoads.Add(1)
+			values[key] = v
+		}
+		return values, errs
+	}
+
+	vals, err := g.GetMulti(ctx, keys)
+	for _, key := range keys {
+		var keyErr error
+		if err != nil {
+			keyErr = wrapError(ErrOriginFailed, key, err)
+		} else if b, ok := vals[key]; ok {
+			v := ByteView{b: cloneBytes(b)}
+			c.populateCache(key, v, 0)
+			c.stats.localLoads.Add(1)
+			values[key] = v
+			continue
+		} else {
+			keyErr = &Error{Kind: ErrNotFound, Key: key}
+		}
+		c.stats.localLoadErrs.Add(1)
+		if errors.Is(keyErr, ErrNotFound) {
+			c.rememberNotFound(key)
+		}
+		errs[key] = keyErr
+	}
+	return values, errs
+}
@@ -0,0 +1,244 @@
+package gcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// batchDB 同时实现了Getter和BatchGetter，"bad"加载失败，不在data中的key不存在
+type batchDB struct {
+	data      map[string]string
+	gets      int64
+	batches   int64
+	batchKeys int64
+	release   chan struct{}
+}
+
+func (db *batchDB) Get(key string) ([]byte, error) {
+	atomic.AddInt64(&db.gets, 1)
+	if key == "bad" {
+		return nil, errors.New("db down")
+	}
+	if v, ok := db.data[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, ErrNotFound
+}
+
+func (db *batchDB) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	atomic.AddInt64(&db.batches, 1)
+	atomic.AddInt64(&db.batchKeys, int64(len(keys)))
+	if db.release != nil {
+		<-db.release
+	}
+	values := map[string][]byte{}
+	for _, key := range keys {
+		if key == "bad" {
+			return nil, errors.New("db down")
+		}
+		if v, ok := db.data[key]; ok {
+			values[key] = []byte(v)
+		}
+	}
+	return values, nil
+}
+
+func TestGetMulti(t *testing.T) {
+	db := &batchDB{data: map[string]string{"a": "1", "b": "2", "c": "3"}}
+	c := NewCacheWithOptions(64<<10, db, Options{NegativeTTL: time.Minute})
+	c.Get("a")
+
+	values, err := c.GetMulti([]string{"a", "b", "c", "b", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 3 || values["a"].String() != "1" || values["b"].String() != "2" || values["c"].String() != "3" {
+		t.Errorf("values = %v", values)
+	}
+	//命中的 key 不再加载，没有命中的 key 只调用一次 BatchGetter
+	if db.batches != 1 || db.batchKeys != 3 {
+		t.Errorf("batches = %d, batchKeys = %d", db.batches, db.batchKeys)
+	}
+	//加载的值放入缓存，不存在的 key 进入负缓存
+	if !c.Contains("b") {
+		t.Error("加载的值应该放入缓存")
+	}
+	if _, err := c.Get("missing"); !errors.Is(err, ErrNotFound) || db.gets != 1 {
+		t.Errorf("err = %v, gets = %d", err, db.gets)
+	}
+
+	values, err = c.GetMulti([]string{"a", "", "bad"})
+	var errs MultiError
+	if !errors.As(err, &errs) || len(errs) != 2 || errs[""] != ErrKeyRequired || !errors.Is(errs["bad"], ErrOriginFailed) {
+		t.Errorf("err = %v", err)
+	}
+	if len(values) != 1 || values["a"].String() != "1" {
+		t.Errorf("values = %v", values)
+	}
+}
+
+func TestGetMultiDedup(t *testing.T) {
+	db := &batchDB{data: map[string]string{"a": "1", "b": "2"}, release: make(chan struct{})}
+	c := NewCache(64<<10, db)
+	done := make(chan map[string]ByteView)
+	go func() {
+		values, _ := c.GetMulti([]string{"a", "b"})
+		done <- values
+	}()
+	time.Sleep(20 * time.Millisecond)
+	//同时进行的 Get 共享批量加载的结果
+	got := make(chan ByteView)
+	go func() {
+		v, _ := c.Get("a")
+		got <- v
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(db.release)
+	if v := <-got; v.String() != "1" {
+		t.Errorf("v = %v", v)
+	}
+	if values := <-done; len(values) != 2 {
+		t.Errorf("values = %v", values)
+	}
+	if db.gets != 0 || db.batches != 1 {
+		t.Errorf("gets = %d, batches = %d", db.gets, db.batches)
+	}
+	if s := c.Stats(); s.DedupLoads != 1 || s.LocalLoads != 2 {
+		t.Errorf("stats = %+v", s)
+	}
+
+	//ctx 已经结束时不加载
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.GetMultiContext(ctx, []string{"x"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestGetMultiPeer(t *testing.T) {
+	//所有者没有实现 BatchGetter，每个 key 的错误分别返回
+	var ownerGets int64
+	var posts int64
+	_, srv := startOwner(t, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt64(&ownerGets, 1)
+		return (&batchDB{data: map[string]string{"a": "1", "b": "2"}}).Get(key)
+	}), func(r *http.Request) {
+		if r.Method == http.MethodPost {
+			atomic.AddInt64(&posts, 1)
+		}
+	})
+
+	selfDB := &batchDB{data: map[string]string{"a": "local"}}
+	c := NewCache(64<<10, selfDB)
+	usePeer(c, srv.URL)
+
+	values, err := c.GetMulti([]string{"a", "b", "missing", "bad"})
+	//所有者返回的加载失败在本地重试，本地也失败
+	var errs MultiError
+	if !errors.As(err, &errs) || len(errs) != 1 || !errors.Is(errs["bad"], ErrOriginFailed) {
+		t.Errorf("err = %v", err)
+	}
+	if len(values) != 2 || values["a"].String() != "1" || values["b"].String() != "2" {
+		t.Errorf("values = %v", values)
+	}
+	//每个 peer 只发一次请求
+	if posts != 1 || ownerGets != 4 {
+		t.Errorf("posts = %d, ownerGets = %d", posts, ownerGets)
+	}
+	//所有者返回的不存在是确定的，只有加载失败的 key 在本地加载
+	if selfDB.batches != 1 || selfDB.batchKeys != 1 {
+		t.Errorf("本地只应该加载 bad, batches = %d, batchKeys = %d", selfDB.batches, selfDB.batchKeys)
+	}
+	//missing 在所有者上不存在，不算作 peer 加载失败
+	if s := c.Stats(); s.PeerLoads != 2 || s.PeerErrors != 1 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestGetMultiPeerTimeout(t *testing.T) {
+	//所有者收到请求时已经超时，部分 key 没有结果
+	var expired int32 = 1
+	_, srv := startOwner(t, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key + key), nil
+	}), func(r *http.Request) {
+		if atomic.LoadInt32(&expired) == 1 {
+			r.Header.Set(timeoutHeader, "-1ms")
+		}
+	})
+	c := NewCacheWithOptions(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("db down")
+	}), Options{NegativeTTL: time.Minute})
+	usePeer(c, srv.URL)
+
+	_, err := c.GetMulti([]string{"a", "b"})
+	var errs MultiError
+	if !errors.As(err, &errs) || len(errs) != 2 || errors.Is(errs["a"], ErrNotFound) {
+		t.Errorf("err = %v", err)
+	}
+	//超时不能当成不存在放入负缓存
+	atomic.StoreInt32(&expired, 0)
+	if v, err := c.Get("a"); err != nil || v.String() != "aa" {
+		t.Errorf("获得的 kv 不是预期的: %v %v", v, err)
+	}
+}
+
+func TestGetMultiFallback(t *testing.T) {
+	//两个 peer 都不可用，从它们加载失败的 key 只在本地批量加载一次
+	var urls []string
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+		urls = append(urls, srv.URL)
+	}
+	db := &batchDB{data: map[string]string{}}
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		db.data[key] = key
+		keys = append(keys, key)
+	}
+	c := NewCache(64<<10, db)
+	pool := NewHTTPPool("self")
+	pool.AddPeers(urls...)
+	c.RegisterHTTPPool(pool)
+
+	values, err := c.GetMulti(keys)
+	if err != nil || len(values) != len(keys) {
+		t.Fatalf("values = %v, err = %v", values, err)
+	}
+	if db.batches != 1 || db.batchKeys != int64(len(keys)) {
+		t.Errorf("batches = %d, batchKeys = %d", db.batches, db.batchKeys)
+	}
+}
+
+// failingPeer 整个批量请求都失败的peer，返回的错误没有key
+type failingPeer struct{}
+
+func (failingPeer) Get(key string) ([]byte, error) { return nil, errors.New("connection refused") }
+
+func (failingPeer) GetMulti(ctx context.Context, keys []string) (map[string][]byte, map[string]error, error) {
+	return nil, nil, &Error{Kind: ErrPeerUnavailable, Err: errors.New("connection refused")}
+}
+
+func TestGetMultiPeerBatchError(t *testing.T) {
+	c := NewCache(64<<10, GetterFunc(func(key string) ([]byte, error) { return nil, ErrNotFound }))
+	//ctx 已经结束，错误直接返回给调用方
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, errs, fallback := c.getMultiFromPeer(ctx, failingPeer{}, []string{"a", "b"})
+	if len(errs) != 2 || len(fallback) != 0 {
+		t.Fatalf("errs = %v, fallback = %v", errs, fallback)
+	}
+	for key, err := range errs {
+		var e *Error
+		if !errors.As(err, &e) || e.Key != key || !errors.Is(err, ErrPeerUnavailable) {
+			t.Errorf("%s: err = %v", key, err)
+		}
+	}
+}
@@ -1,5 +1,11 @@
 package gcache
 
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
 // PeerPicker 可以通过PeerPicker接口找到对应key的peer(对等节点)
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
@@ -9,3 +15,37 @@ type PeerPicker interface {
 type PeerGetter interface {
 	Get(key string) ([]byte, error)
 }
+
+// ContextPeerGetter PeerGetter可以同时实现这个接口，ctx的截止时间会传给远端peer
+type ContextPeerGetter interface {
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+// BatchPeerGetter PeerGetter可以同时实现这个接口，GetMulti对每个peer只发一次请求获取多个key；
+// values和errs中都没有的key在peer上不存在，err不为nil时整个请求失败
+type BatchPeerGetter interface {
+	GetMulti(ctx context.Context, keys []string) (values map[string][]byte, errs map[string]error, err error)
+}
+
+// PeerSetter PeerGetter可以同时实现这个接口，Set把值写入key的所有者，ttl<=0 时使用所有者的DefaultTTL
+type PeerSetter interface {
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// PeerDeleter PeerGetter可以同时实现这个接口，Delete删除peer本地缓存中的key，返回是否有缓存项被删除
+type PeerDeleter interface {
+	Delete(ctx context.Context, key string) (bool, error)
+}
+
+// PeerLister PeerPicker可以同时实现这个接口，返回除自己之外的所有peer，用于广播失效
+type PeerLister interface {
+	AllPeers() []PeerGetter
+}
+
+// peerName 返回peer的名字，peer实现了fmt.Stringer时使用String()
+func peerName(peer PeerGetter) string {
+	if s, ok := peer.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T(%p)", peer, peer)
+}
@@ -0,0 +1,176 @@
+package gcache
+
+import (
+	"gcache/arc"
+	"gcache/arena"
+	"gcache/lfu"
+	"gcache/lru"
+	"time"
+)
+
+// Policy 缓存淘汰策略，csCache在持有锁的情况下调用，实现不需要并发安全。
+// lru.Cache、lfu.Cache、arc.Cache 都实现了Policy接口。
+type Policy interface {
+	// AddWithExpire 添加一个值，expire为零值表示永不过期
+	AddWithExpire(key string, value lru.Value, expire time.Time)
+	// Get 查找key的值，并按策略更新key的访问记录
+	Get(key string) (value lru.Value, ok bool)
+	// Peek 查找key的值，不更新key的访问记录，也不删除已过期的key
+	Peek(key string) (value lru.Value, ok bool)
+	// Victim 返回加入key之后最先被淘汰的key，key已经存在或者加入key不需要淘汰时ok为false
+	Victim(key string, value lru.Value) (victim string, ok bool)
+	// Delete 删除某key
+	Delete(key string) bool
+	// RemoveExpired 删除所有已过期的值，返回删除的个数
+	RemoveExpired() int
+	// Len 返回缓存k-v的个数
+	Len() int
+	// Stats 返回晋升次数和每个链表的统计信息
+	Stats() lru.Stats
+	// Snapshot 返回所有未过期的缓存项，每个链表内按从最久没访问到最近访问的顺序
+	Snapshot() []lru.Entry
+	// Restore 把Snapshot返回的缓存项加入到它原来所在的链表
+	Restore(e lru.Entry)
+	// Clear 清空缓存
+	Clear()
+	// Resize 修改容量，不会立即淘汰
+	Resize(maxCap int)
+	// Trim 超出容量时最多淘汰n个缓存项，返回是否已经不超出容量
+	Trim(n int) bool
+}
+
+// EvictedFunc 缓存项被移除时的回调
+type EvictedFunc func(key string, value lru.Value, reason lru.EvictReason)
+
+// PolicyFactory 创建一个容量为maxCap的淘汰策略，缓存项被移除时需要调用onEvicted(可能为nil)
+type PolicyFactory func(maxCap int, onEvicted EvictedFunc) Policy
+
+// LRUPolicy 返回按opts配置的中点插入LRU(old、young两个链表)，也是默认的淘汰策略
+func LRUPolicy(opts lru.Options) PolicyFactory {
+	return func(maxCap int, onEvicted EvictedFunc) Policy {
+		c := lru.NewWithOptions(maxCap, opts)
+		c.OnEvicted = onEvicted
+		return c
+	}
+}
+
+// LFUPolicy 淘汰访问次数最少的key
+func LFUPolicy(maxCap int, onEvicted EvictedFunc) Policy {
+	c := lfu.New(maxCap)
+	c.OnEvicted = onEvicted
+	return c
+}
+
+// ARCPolicy 自适应替换缓存，根据访问模式在LRU和LFU之间自动调整
+func ARCPolicy(maxCap int, onEvicted EvictedFunc) Policy {
+	c := arc.New(maxCap)
+	c.OnEvicted = onEvicted
+	return c
+}
+
+// ArenaPolicy 把key和value存放在预先分配的大块字节数组里，索引不含指针，缓存项很多时GC的开销不会随之增长。
+// 按FIFO淘汰，Get返回的是从arena中拷贝出来的ByteView。maxCap为0时使用arena.DefaultSize。
+func ArenaPolicy(maxCap int, onEvicted EvictedFunc) Policy {
+	c := arena.New(maxCap)
+	if onEvicted != nil {
+		c.OnEvicted = func(key string, value []byte, reason arena.Reason) {
+			onEvicted(key, ByteView{b: cloneBytes(value)}, lru.EvictReason(reason))
+		}
+	}
+	return &arenaPolicy{c: c}
+}
+
+// ArenaPolicy直接把arena.Reason转换成lru.EvictReason，两者的取值不一致时数组下标越界，编译失败
+var (
+	_ = [1]struct{}{}[arena.ReasonCapacity-arena.Reason(lru.EvictCapacity)]
+	_ = [1]struct{}{}[arena.ReasonExpired-arena.Reason(lru.EvictExpired)]
+	_ = [1]struct{}{}[arena.ReasonDeleted-arena.Reason(lru.EvictDeleted)]
+	_ = [1]struct{}{}[arena.ReasonReplaced-arena.Reason(lru.EvictReplaced)]
+	_ = [1]struct{}{}[arena.ReasonCleared-arena.Reason(lru.EvictCleared)]
+)
+
+// arenaPolicy 把arena.Cache适配成Policy，value只能是ByteView
+type arenaPolicy struct {
+	c *arena.Cache
+}
+
+func (p *arenaPolicy) AddWithExpire(key string, value lru.Value, expire time.Time) {
+	p.c.Set(key, value.(ByteView).b, expire)
+}
+
+func (p *arenaPolicy) Get(key string) (value lru.Value, ok bool) {
+	b, ok := p.c.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return ByteView{b: b}, true
+}
+
+func (p *arenaPolicy) Peek(key string) (value lru.Value, ok bool) {
+	b, ok := p.c.Peek(key)
+	if !ok {
+		return nil, false
+	}
+	return ByteView{b: b}, true
+}
+
+func (p *arenaPolicy) Victim(key string, value lru.Value) (victim string, ok bool) {
+	return p.c.Victim(key, value.Len())
+}
+
+func (p *arenaPolicy) Delete(key string) bool {
+	return p.c.Delete(key)
+}
+
+func (p *arenaPolicy) RemoveExpired() int {
+	return p.c.RemoveExpired()
+}
+
+func (p *arenaPolicy) Len() int {
+	return p.c.Len()
+}
+
+func (p *arenaPolicy) Stats() lru.Stats {
+	bytes, items := int64(p.c.Bytes()), int64(p.c.Len())
+	return lru.Stats{
+		Bytes: bytes,
+		Items: items,
+		Lists: []lru.ListStats{{Name: "arena", Bytes: bytes, Items: items}},
+	}
+}
+
+func (p *arenaPolicy) Snapshot() []lru.Entry {
+	var entries []lru.Entry
+	now := time.Now()
+	p.c.Range(func(key string, value []byte, expire time.Time) bool {
+		if expire.IsZero() || expire.After(now) {
+			entries = append(entries, lru.Entry{Key: key, Value: ByteView{b: cloneBytes(value)}, Expire: expire, List: "arena"})
+		}
+		return true
+	})
+	return entries
+}
+
+func (p *arenaPolicy) Restore(e lru.Entry) {
+	p.c.Set(e.Key, e.Value.(ByteView).b, e.Expire)
+}
+
+func (p *arenaPolicy) Clear() {
+	p.c.Clear()
+}
+
+// Resize 扩容时立即重新分配arena，缩容时由Trim分批淘汰；两者都会在持有锁时拷贝一次所有有效的缓存项
+func (p *arenaPolicy) Resize(maxCap int) {
+	p.c.Resize(maxCap)
+}
+
+func (p *arenaPolicy) Trim(n int) bool {
+	return p.c.Trim(n)
+}
+
+var (
+	_ Policy = (*lru.Cache)(nil)
+	_ Policy = (*lfu.Cache)(nil)
+	_ Policy = (*arc.Cache)(nil)
+	_ Policy = (*arenaPolicy)(nil)
+)
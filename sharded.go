@@ -0,0 +1,147 @@
+package gcache
+
+import (
+	"gcache/lru"
+	"gcache/tinylfu"
+	"time"
+)
+
+// shardedCache 按key的哈希把缓存分散到多个相互独立的csCache，每个分片有自己的锁和容量，减少多核下的锁竞争
+type shardedCache struct {
+	shards []*csCache
+}
+
+// newShardedCache 创建n个分片，maxCap按shardCap分给每个分片
+func newShardedCache(n, maxCap int, newPolicy PolicyFactory, admissionCounters int,
+	onEvicted func(key string, value ByteView, reason lru.EvictReason)) *shardedCache {
+	if n <= 0 {
+		n = 1
+	}
+	s := &shardedCache{shards: make([]*csCache, n)}
+	for i := range s.shards {
+		s.shards[i] = &csCache{maxCap: shardCap(maxCap, n, i), newPolicy: newPolicy, onEvicted: onEvicted}
+		if admissionCounters > 0 {
+			s.shards[i].admission = tinylfu.New(admissionCounters / n)
+		}
+	}
+	return s
+}
+
+// index 返回key所在分片的下标
+func (s *shardedCache) index(key string) int {
+	if len(s.shards) == 1 {
+		return 0
+	}
+	return int(fnv32(key) % uint32(len(s.shards)))
+}
+
+// shardCap 返回n个分片中第i个的容量：maxCap/n，余数分给前面的分片；
+// 分片的容量为0表示不限制，所以maxCap>0时每个分片至少为1
+func shardCap(maxCap, n, i int) int {
+	c := maxCap / n
+	if i < maxCap%n {
+		c++
+	}
+	if c == 0 && maxCap > 0 {
+		c = 1
+	}
+	return c
+}
+
+// shard 返回key所在的分片
+func (s *shardedCache) shard(key string) *csCache {
+	return s.shards[s.index(key)]
+}
+
+func (s *shardedCache) add(key string, value ByteView, expire time.Time) {
+	s.shard(key).add(key, value, expire)
+}
+
+func (s *shardedCache) set(key string, value ByteView, expire time.Time) {
+	s.shard(key).set(key, value, expire)
+}
+
+func (s *shardedCache) get(key string) (value ByteView, ok bool) {
+	return s.shard(key).get(key)
+}
+
+func (s *shardedCache) delete(key string) bool {
+	return s.shard(key).delete(key)
+}
+
+func (s *shardedCache) peek(key string) (value ByteView, ok bool) {
+	return s.shard(key).peek(key)
+}
+
+// len 返回所有分片的k-v个数之和
+func (s *shardedCache) len() int {
+	n := 0
+	for _, c := range s.shards {
+		n += c.len()
+	}
+	return n
+}
+
+// rangeEntries 逐个分片遍历未过期的缓存项，fn在分片的锁外调用，返回false时停止
+func (s *shardedCache) rangeEntries(fn func(e lru.Entry) bool) {
+	for _, c := range s.shards {
+		for _, e := range c.snapshot() {
+			if !fn(e) {
+				return
+			}
+		}
+	}
+}
+
+// removeExpired 逐个分片删除已过期的值，返回删除的个数
+func (s *shardedCache) removeExpired() int {
+	n := 0
+	for _, c := range s.shards {
+		n += c.removeExpired()
+	}
+	return n
+}
+
+func (s *shardedCache) clear() {
+	for _, c := range s.shards {
+		c.clear()
+	}
+}
+
+// fnv32 FNV-1a 32，不需要像hash/fnv那样分配内存
+func fnv32(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
+
+// resize 把总容量修改为maxCap，按shardCap分给每个分片
+func (s *shardedCache) resize(maxCap int) {
+	for i, c := range s.shards {
+		c.resize(shardCap(maxCap, len(s.shards), i))
+	}
+}
+
+// snapshot 返回所有分片中未过期的缓存项
+func (s *shardedCache) snapshot() []lru.Entry {
+	var entries []lru.Entry
+	for _, c := range s.shards {
+		entries = append(entries, c.snapshot()...)
+	}
+	return entries
+}
+
+// restore 把快照中的缓存项按key分配到各个分片，分片个数可以和快照时不同
+func (s *shardedCache) restore(entries []lru.Entry) {
+	parts := make([][]lru.Entry, len(s.shards))
+	for _, e := range entries {
+		i := s.index(e.Key)
+		parts[i] = append(parts[i], e)
+	}
+	for i, c := range s.shards {
+		c.restore(parts[i])
+	}
+}
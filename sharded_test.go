@@ -0,0 +1,140 @@
+package gcache
+
+import (
+	"fmt"
+	"gcache/lru"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestShardedCache(t *testing.T) {
+	s := newShardedCache(4, 64<<10, LRUPolicy(lru.Options{}), 0, nil)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		s.add(key, ByteView{b: []byte(key)}, time.Time{})
+	}
+	used := 0
+	for _, shard := range s.shards {
+		if shard.maxCap != 16<<10 {
+			t.Errorf("分片容量为 %d, 预期 %d", shard.maxCap, 16<<10)
+		}
+		if shard.policy != nil {
+			used++
+		}
+	}
+	if used != 4 {
+		t.Errorf("%d 个分片被使用, 预期 4 个", used)
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if v, ok := s.get(key); !ok || v.String() != key {
+			t.Errorf("获得的 %s 不是预期的", key)
+		}
+	}
+	if !s.delete("key0") || s.delete("key0") {
+		t.Error("delete err")
+	}
+}
+
+func benchmarkShardedGet(b *testing.B, shards int) {
+	keys := make([]string, 1<<12)
+	s := newShardedCache(shards, 64<<20, LRUPolicy(lru.Options{}), 0, nil)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+		s.add(keys[i], ByteView{b: []byte(keys[i])}, time.Time{})
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		//每个goroutine从不同的位置开始，避免同时访问同一个分片
+		i := rand.Intn(len(keys))
+		for pb.Next() {
+			s.get(keys[i%len(keys)])
+			i++
+		}
+	})
+}
+
+func BenchmarkShardedGet1(b *testing.B)  { benchmarkShardedGet(b, 1) }
+func BenchmarkShardedGet4(b *testing.B)  { benchmarkShardedGet(b, 4) }
+func BenchmarkShardedGet16(b *testing.B) { benchmarkShardedGet(b, 16) }
+func BenchmarkShardedGet32(b *testing.B) { benchmarkShardedGet(b, 32) }
+
+func TestShardedResize(t *testing.T) {
+	for name, newPolicy := range map[string]PolicyFactory{"lru": LRUPolicy(lru.Options{}), "arena": ArenaPolicy} {
+		var evicted int
+		s := newShardedCache(2, 4<<10, newPolicy, 0, func(string, ByteView, lru.EvictReason) {
+			evicted++
+		})
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("key%03d", i)
+			s.add(key, ByteView{b: []byte(key)}, time.Time{})
+		}
+		var stats Stats
+		s.addStats(&stats)
+		evicted = 0
+		s.resize(1 << 10)
+		var after Stats
+		s.addStats(&after)
+		if after.Bytes > 1<<10 {
+			t.Errorf("%s: 缩容之后使用了 %d 字节, 超出容量", name, after.Bytes)
+		}
+		if evicted == 0 || int64(evicted) != stats.Items-after.Items || after.Evictions != stats.Evictions+int64(evicted) {
+			t.Errorf("%s: 淘汰了 %d 个 kv, 统计信息不一致", name, evicted)
+		}
+	}
+}
+
+func TestShardedSmallCap(t *testing.T) {
+	//maxCap 比分片个数小时每个分片仍然有容量限制
+	s := newShardedCache(8, 4, LRUPolicy(lru.Options{}), 0, nil)
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("key%d", i)
+			s.add(key, ByteView{b: []byte(key)}, time.Time{})
+		}
+		if n := s.len(); n != 0 {
+			t.Errorf("round %d: 容量为 4 字节的缓存保存了 %d 个 kv", round, n)
+		}
+		s.resize(3)
+	}
+	//余数分给前面的分片，总容量不变
+	total := 0
+	for i := 0; i < 4; i++ {
+		total += shardCap(10, 4, i)
+	}
+	if total != 10 || shardCap(0, 4, 0) != 0 {
+		t.Errorf("total = %d, 预期 10", total)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	c := NewCacheWithOptions(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), Options{Shards: 4, AdmissionCounters: 1024})
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		c.populateCache(key, ByteView{b: []byte(key)}, 0)
+	}
+	if v, ok := c.Peek("key1"); !ok || v.String() != "key1" || !c.Contains("key2") || c.Contains("key10") {
+		t.Error("Peek、Contains 的结果不是预期的")
+	}
+	if s := c.Stats(); s.Gets != 0 || s.Hits != 0 {
+		t.Errorf("Peek 不应该计入统计: %+v", s)
+	}
+	if c.Len() != 10 || len(c.Keys()) != 10 {
+		t.Errorf("Len = %d, Keys = %v", c.Len(), c.Keys())
+	}
+	n := 0
+	c.Range(func(e lru.Entry) bool {
+		//回调中可以访问缓存
+		if !c.Contains(e.Key) || e.Value.(ByteView).String() != e.Key {
+			t.Errorf("%s 不是预期的", e.Key)
+		}
+		n++
+		return n < 5
+	})
+	if n != 5 {
+		t.Errorf("遍历了 %d 个, 预期 5 个", n)
+	}
+}
@@ -0,0 +1,353 @@
+package singleflight
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Group 和Ones一样合并同一个key的并发调用，但key和结果是有类型的，零值可以直接使用。
+// fn在单独的goroutine中执行：调用方的ctx结束时只是不再等待，不会取消共享的fn；
+// 所有等待的调用方都离开之后，传给fn的ctx才会被取消，之后的调用重新执行fn。
+type Group[K comparable, V any] struct {
+	//SuccessWindow、ErrorWindow 和Ones的同名字段含义相同
+	SuccessWindow time.Duration
+	ErrorWindow   time.Duration
+
+	mu        sync.Mutex
+	m         map[K]*groupCall[K, V] //延迟初始化
+	completed [2][]*groupCall[K, V]
+}
+
+// groupCall 正在进行或者还在复用窗口内的Group调用
+type groupCall[K comparable, V any] struct {
+	key K
+	//done fn返回之后关闭，之后val、err不再改变
+	done chan struct{}
+	val  V
+	err  error
+	//waiters 还在等待结果的调用方个数，dups 加入这次调用的其他调用方个数，expire 复用窗口结束的时间，都在g.mu保护下读写
+	waiters int
+	dups    int
+	expire  time.Time
+	//ctx 传给fn的context，cancel 所有等待方都离开时调用，取消ctx
+	ctx    *loadContext
+	cancel func()
+}
+
+// lookup 返回key正在进行或者还在复用窗口内的调用，并删除已经过期的调用，调用方需要持有mu
+func (g *Group[K, V]) lookup(key K) (*groupCall[K, V], bool) {
+	if g.m == nil {
+		g.m = make(map[K]*groupCall[K, V])
+	}
+	now := time.Now()
+	for i := range g.completed {
+		q := g.completed[i]
+		for len(q) > 0 && !now.Before(q[0].expire) {
+			g.remove(q[0])
+			q[0] = nil
+			q = q[1:]
+		}
+		g.completed[i] = q
+	}
+	c, ok := g.m[key]
+	return c, ok
+}
+
+// remove 把c从m中删除，key可能已经对应新的调用
+func (g *Group[K, V]) remove(c *groupCall[K, V]) {
+	if g.m[c.key] == c {
+		delete(g.m, c.key)
+	}
+}
+
+// Do 同一个key同时只有一个fn在执行，其他调用方等待并共享它的结果；ctx结束时返回ctx.Err()。
+// fn panic时等待的调用方以*PanicError再次panic，fn调用了runtime.Goexit时返回ErrGoexit。
+func (g *Group[K, V]) Do(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (V, error) {
+	v, err, _ := g.DoShared(ctx, key, fn)
+	return v, err
+}
+
+// DoShared 和Do一样，shared表示这次调用没有执行fn，而是加入了正在进行或者还在复用窗口内的调用，
+// ctx结束提前返回时也是如此；和Ones.DoShared不同，执行fn的调用方得到的shared总是false。
+func (g *Group[K, V]) DoShared(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (v V, err error, shared bool) {
+	g.mu.Lock()
+	c, shared := g.lookup(key)
+	if shared {
+		c.dups++
+	} else {
+		c = &groupCall[K, V]{key: key, done: make(chan struct{})}
+		c.ctx, c.cancel = newLoadContext(ctx)
+		g.m[key] = c
+		go g.run(c, fn)
+	}
+	c.waiters++
+	c.ctx.join(ctx)
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		if e, ok := c.err.(*PanicError); ok {
+			panic(e)
+		}
+		return c.val, c.err, shared
+	case <-ctx.Done():
+		g.leave(c)
+		return v, ctx.Err(), shared
+	}
+}
+
+// leave 调用方不再等待c，最后一个调用方离开时取消fn，并让之后的调用重新执行fn
+func (g *Group[K, V]) leave(c *groupCall[K, V]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.waiters--
+	if c.waiters > 0 {
+		return
+	}
+	select {
+	case <-c.done:
+		//fn已经返回，结果按复用窗口处理
+	default:
+		c.cancel()
+		g.remove(c)
+	}
+}
+
+// DoMulti 和对每个key调用Do一样，但没有正在进行或者可以复用的调用的key合并成一次fn调用，
+// fn返回这些key的值或者错误，两者都没有的key得到ErrNoResult。ctx结束时还没有结果的key得到ctx.Err()。
+// 合并的fn在所有key的调用方都离开之后才会被取消；fn panic时等待的调用方以*PanicError再次panic。
+// shared是和DoShared含义相同的、加入了其他调用而没有交给fn的key。
+func (g *Group[K, V]) DoMulti(ctx context.Context, keys []K, fn func(ctx context.Context, keys []K) (map[K]V, map[K]error)) (vals map[K]V, errs map[K]error, shared map[K]bool) {
+	calls := make(map[K]*groupCall[K, V], len(keys))
+	shared = make(map[K]bool)
+	var owned []*groupCall[K, V]
+	loadCtx, cancel := newLoadContext(ctx)
+	//合并的调用共用一个ctx，所有调用的等待方都离开之后才取消
+	left := 0
+	leave := func() {
+		if left++; left == len(owned) {
+			cancel()
+		}
+	}
+
+	g.mu.Lock()
+	for _, key := range keys {
+		if _, ok := calls[key]; ok {
+			continue
+		}
+		c, ok := g.lookup(key)
+		if ok {
+			c.dups++
+			shared[key] = true
+		} else {
+			c = &groupCall[K, V]{key: key, done: make(chan struct{}), ctx: loadCtx, cancel: leave}
+			g.m[key] = c
+			owned = append(owned, c)
+		}
+		c.waiters++
+		c.ctx.join(ctx)
+		calls[key] = c
+	}
+	g.mu.Unlock()
+	if len(owned) > 0 {
+		go g.runMulti(owned, loadCtx, cancel, fn)
+	} else {
+		cancel()
+	}
+
+	vals = make(map[K]V, len(calls))
+	errs = make(map[K]error)
+	var panicErr *PanicError
+	for key, c := range calls {
+		select {
+		case <-c.done:
+			if e, ok := c.err.(*PanicError); ok {
+				panicErr = e
+			} else if c.err != nil {
+				errs[key] = c.err
+			} else {
+				vals[key] = c.val
+			}
+		case <-ctx.Done():
+			g.leave(c)
+			errs[key] = ctx.Err()
+		}
+	}
+	if panicErr != nil {
+		panic(panicErr)
+	}
+	return vals, errs, shared
+}
+
+// run 调用fn并记录结果
+func (g *Group[K, V]) run(c *groupCall[K, V], fn func(ctx context.Context) (V, error)) {
+	protect(func() {
+		c.val, c.err = fn(c.ctx)
+	}, func(err error) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if err != nil {
+			c.err = err
+		}
+		g.finish(c)
+		c.cancel()
+	})
+}
+
+// runMulti 用calls的key调用一次fn，并把结果分发给每个调用
+func (g *Group[K, V]) runMulti(calls []*groupCall[K, V], ctx context.Context, cancel context.CancelFunc, fn func(ctx context.Context, keys []K) (map[K]V, map[K]error)) {
+	keys := make([]K, len(calls))
+	for i, c := range calls {
+		keys[i] = c.key
+	}
+	var (
+		vals map[K]V
+		errs map[K]error
+	)
+	protect(func() {
+		vals, errs = fn(ctx, keys)
+	}, func(err error) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		for _, c := range calls {
+			if err != nil {
+				c.err = err
+			} else if e, ok := errs[c.key]; ok {
+				c.err = e
+			} else if v, ok := vals[c.key]; ok {
+				c.val = v
+			} else {
+				c.err = ErrNoResult
+			}
+			g.finish(c)
+		}
+		cancel()
+	})
+}
+
+// finish 唤醒等待c的调用方，并按结果的复用窗口记录过期时间，调用方需要持有mu
+func (g *Group[K, V]) finish(c *groupCall[K, V]) {
+	close(c.done)
+
+	window := reuseWindow(g.SuccessWindow, g.ErrorWindow, c.err)
+	//已经被取消或者Forget的调用不再复用
+	if _, ok := c.err.(*PanicError); ok || c.err == ErrGoexit || window <= 0 || g.m[c.key] != c {
+		g.remove(c)
+		return
+	}
+	c.expire = time.Now().Add(window)
+	i := 0
+	if c.err != nil {
+		i = 1
+	}
+	g.completed[i] = append(g.completed[i], c)
+}
+
+// Forget 让之后的调用不再等待或者复用key当前的调用，而是重新执行fn
+func (g *Group[K, V]) Forget(key K) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.m, key)
+}
+
+// loadContext 传给Group的fn的context：Value来自发起调用的ctx，所有调用方都离开或者到达Deadline时取消；
+// Deadline为所有调用方中最晚的截止时间，有调用方没有截止时间时没有截止时间。
+type loadContext struct {
+	//Context 只用于取消，不继承parent的取消和截止时间
+	context.Context
+	parent context.Context
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	deadline   time.Time
+	noDeadline bool
+	//timer 在deadline取消Context，join推迟deadline时重新设置
+	timer   *time.Timer
+	expired bool
+	stopped bool
+}
+
+func newLoadContext(parent context.Context) (*loadContext, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &loadContext{Context: ctx, parent: parent, cancel: cancel}
+	return c, c.stop
+}
+
+// join 加入一个调用方，用它的截止时间更新Deadline
+func (c *loadContext) join(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped || c.noDeadline {
+		return
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		c.noDeadline = true
+		c.stopTimer()
+		return
+	}
+	if !deadline.After(c.deadline) {
+		return
+	}
+	c.deadline = deadline
+	c.stopTimer()
+	c.timer = time.AfterFunc(time.Until(deadline), c.expire)
+}
+
+// stopTimer 调用方需要持有mu
+func (c *loadContext) stopTimer() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+}
+
+// expire 到达deadline时取消Context，Err返回context.DeadlineExceeded
+func (c *loadContext) expire() {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return
+	}
+	c.expired = true
+	c.stopped = true
+	c.timer = nil
+	c.mu.Unlock()
+	c.cancel()
+}
+
+// stop 所有调用方都离开或者fn返回时取消Context
+func (c *loadContext) stop() {
+	c.mu.Lock()
+	c.stopped = true
+	c.stopTimer()
+	c.mu.Unlock()
+	c.cancel()
+}
+
+func (c *loadContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.noDeadline || c.deadline.IsZero() {
+		return time.Time{}, false
+	}
+	return c.deadline, true
+}
+
+func (c *loadContext) Err() error {
+	err := c.Context.Err()
+	if err == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.expired {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+func (c *loadContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
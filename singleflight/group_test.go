@@ -0,0 +1,218 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupDo(t *testing.T) {
+	var g Group[int, string]
+	var calls, shared int64
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		atomic.AddInt64(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, ok := g.DoShared(context.Background(), 1, fn)
+			if v != "bar" || err != nil {
+				t.Errorf("DoShared = %v, %v", v, err)
+			}
+			if ok {
+				atomic.AddInt64(&shared, 1)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	//只有执行 fn 的调用方 shared 为 false
+	if calls != 1 || shared != 9 {
+		t.Errorf("同一个 key 应该只执行一次, calls = %d, shared = %d", calls, shared)
+	}
+}
+
+func TestGroupWaiterCancel(t *testing.T) {
+	g := Group[string, int]{SuccessWindow: -1}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	cancelled := make(chan bool, 1)
+	fn := func(ctx context.Context) (int, error) {
+		close(started)
+		select {
+		case <-release:
+			return 1, nil
+		case <-ctx.Done():
+			cancelled <- true
+			return 0, ctx.Err()
+		}
+	}
+
+	//一个调用方离开，另一个调用方仍然得到结果
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		_, err := g.Do(ctx, "key", fn)
+		errc <- err
+	}()
+	<-started
+	done := make(chan int)
+	go func() {
+		v, _ := g.Do(context.Background(), "key", nil)
+		done <- v
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("离开的调用方应该得到 ctx.Err(), err = %v", err)
+	}
+	close(release)
+	if v := <-done; v != 1 {
+		t.Errorf("还在等待的调用方应该得到结果, v = %v", v)
+	}
+
+	//所有调用方都离开时取消 fn，之后的调用重新执行
+	started = make(chan struct{})
+	release = make(chan struct{})
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := g.Do(ctx, "key", fn); err != context.DeadlineExceeded {
+		t.Errorf("err = %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("所有调用方都离开之后应该取消 fn")
+	}
+	if v, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) { return 2, nil }); v != 2 || err != nil {
+		t.Errorf("取消之后应该重新执行, v = %v, err = %v", v, err)
+	}
+}
+
+func TestGroupContext(t *testing.T) {
+	var g Group[string, time.Time]
+	type ctxKey struct{}
+	release := make(chan struct{})
+	got := make(chan context.Context, 1)
+	fn := func(ctx context.Context) (time.Time, error) {
+		got <- ctx
+		<-release
+		deadline, _ := ctx.Deadline()
+		return deadline, nil
+	}
+
+	first, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "v"), time.Second)
+	defer cancel()
+	go g.Do(first, "key", fn)
+	ctx := <-got
+	if ctx.Value(ctxKey{}) != "v" {
+		t.Error("fn 的 ctx 应该保留调用方的 Value")
+	}
+	//截止时间为所有调用方中最晚的
+	later, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	deadline, err := g.Do(later, "key", nil)
+	want, _ := later.Deadline()
+	if err != nil || !deadline.Equal(want) {
+		t.Errorf("deadline = %v, 预期 %v", deadline, want)
+	}
+}
+
+func TestGroupPanic(t *testing.T) {
+	var g Group[string, int]
+	func() {
+		defer func() {
+			if e, ok := recover().(*PanicError); !ok || e.Value != "boom" {
+				t.Errorf("recover() = %v, 预期 *PanicError", e)
+			}
+		}()
+		g.Do(context.Background(), "key", func(ctx context.Context) (int, error) { panic("boom") })
+	}()
+	if v, _ := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) { return 1, nil }); v != 1 {
+		t.Errorf("panic 之后应该重新执行, v = %v", v)
+	}
+
+	g.Forget("key")
+	errFail := errors.New("fail")
+	if _, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) { return 0, errFail }); err != errFail {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestLoadContextDeadline(t *testing.T) {
+	first, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	later, cancel := context.WithTimeout(context.Background(), 60*time.Millisecond)
+	defer cancel()
+	ctx, stop := newLoadContext(first)
+	defer stop()
+	ctx.join(first)
+	ctx.join(later)
+	//到达最晚的截止时间时 Done 关闭，不依赖调用方离开
+	select {
+	case <-ctx.Done():
+		t.Fatal("没有到达最晚的截止时间不应该取消")
+	case <-time.After(40 * time.Millisecond):
+	}
+	select {
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			t.Errorf("err = %v, 预期 context.DeadlineExceeded", ctx.Err())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("到达截止时间应该取消")
+	}
+
+	//有调用方没有截止时间时不会超时
+	ctx, stop = newLoadContext(first)
+	ctx.join(first)
+	ctx.join(context.Background())
+	select {
+	case <-ctx.Done():
+		t.Error("没有截止时间时不应该超时")
+	case <-time.After(40 * time.Millisecond):
+	}
+	stop()
+	if ctx.Err() != context.Canceled {
+		t.Errorf("err = %v, 预期 context.Canceled", ctx.Err())
+	}
+}
+
+func TestGroupDoMulti(t *testing.T) {
+	var g Group[string, string]
+	release := make(chan struct{})
+	go g.Do(context.Background(), "a", func(ctx context.Context) (string, error) {
+		<-release
+		return "a", nil
+	})
+	time.Sleep(20 * time.Millisecond)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	var got []string
+	vals, errs, shared := g.DoMulti(context.Background(), []string{"a", "b", "c"}, func(ctx context.Context, keys []string) (map[string]string, map[string]error) {
+		got = keys
+		return map[string]string{"b": "b"}, nil
+	})
+	//正在进行的 a 不交给 fn，c 没有返回结果
+	if len(got) != 2 || vals["a"] != "a" || vals["b"] != "b" || errs["c"] != ErrNoResult {
+		t.Errorf("keys = %v, vals = %v, errs = %v", got, vals, errs)
+	}
+	if len(shared) != 1 || !shared["a"] {
+		t.Errorf("shared = %v, 预期只有 a", shared)
+	}
+}
@@ -1,42 +1,263 @@
 package singleflight
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
 	"sync"
 	"time"
 )
 
+// N 以前记录Ones.Do调用fn的次数，并发更新时有数据竞争。
+//
+// Deprecated: 不再更新，保留只是为了兼容已有的代码。
 var N = 0
 
+// DefaultSuccessWindow SuccessWindow为0时，成功的结果继续返回给同一个key的调用方的时间
+const DefaultSuccessWindow = time.Second
+
+// ErrGoexit fn调用了runtime.Goexit，DoChan的调用方在Result.Err中得到它
+var ErrGoexit = errors.New("singleflight: fn called runtime.Goexit")
+
+// ErrNoResult Group.DoMulti的fn没有返回某个key的值或者错误
+var ErrNoResult = errors.New("singleflight: no result for key")
+
+// PanicError fn panic时，Do、DoShared的所有调用方以*PanicError再次panic，DoChan的调用方在Result.Err中得到它
+type PanicError struct {
+	//Value recover()返回的值
+	Value interface{}
+	//Stack panic时fn所在goroutine的调用栈
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: panic in fn: %v\n\n%s", p.Value, p.Stack)
+}
+
+// Unwrap panic的值是error时返回它
+func (p *PanicError) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+func newPanicError(v interface{}) *PanicError {
+	stack := debug.Stack()
+	//去掉第一行 "goroutine N [running]:"，它和再次panic的goroutine不一致
+	if line := bytes.IndexByte(stack, '\n'); line >= 0 {
+		stack = stack[line+1:]
+	}
+	return &PanicError{Value: v, Stack: stack}
+}
+
 // call is an in-flight(正在进行) or completed Do call
 type call struct {
+	key string
 	wg  sync.WaitGroup
 	val interface{}
 	err error
+	//dups 等待这次调用结果的其他调用方个数，chans DoChan的调用方
+	dups  int
+	chans []chan<- Result
+	//done fn已经返回，expire 复用窗口结束的时间，都在g.mu保护下读写
+	done   bool
+	expire time.Time
 }
 
+// Result DoChan返回的结果，Shared表示结果是否同时返回给了多个调用方
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool
+}
+
+// Ones 合并同一个key的并发调用，零值可以直接使用
 type Ones struct {
-	//mu保证m不会被并发读写
+	//SuccessWindow fn成功返回之后，结果继续返回给同一个key的调用方的时间，0表示DefaultSuccessWindow，负数表示不复用
+	SuccessWindow time.Duration
+	//ErrorWindow fn返回错误之后，错误继续返回给同一个key的调用方的时间，0或负数表示不复用
+	ErrorWindow time.Duration
+
+	//mu保证m不会被并发读写，只在读写m时持有，不会在调用fn时持有
 	mu sync.Mutex       // protects m
 	m  map[string]*call //延迟初始化
+	//completed 还在复用窗口内的调用，按完成的顺序排列，[0]为成功的，[1]为失败的；
+	//同一个队列的窗口长度相同，所以expire是递增的，只需要从头部删除过期的调用
+	completed [2][]*call
 }
 
-func (g *Ones) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
-	g.mu.Lock()
-	defer g.mu.Unlock()
+// window 返回err对应的复用窗口
+func (g *Ones) window(err error) time.Duration {
+	return reuseWindow(g.SuccessWindow, g.ErrorWindow, err)
+}
+
+// reuseWindow 按SuccessWindow、ErrorWindow的约定返回err对应的复用窗口
+func reuseWindow(success, failure time.Duration, err error) time.Duration {
+	if err != nil {
+		return failure
+	}
+	if success == 0 {
+		return DefaultSuccessWindow
+	}
+	return success
+}
+
+// lookup 返回key正在进行或者还在复用窗口内的调用，并删除已经过期的调用，调用方需要持有mu
+func (g *Ones) lookup(key string) (*call, bool) {
 	if g.m == nil {
 		g.m = make(map[string]*call)
 	}
-	if c, ok := g.m[key]; ok {
-		return c.val, c.err //请求结束，返回结果
+	now := time.Now()
+	for i := range g.completed {
+		q := g.completed[i]
+		for len(q) > 0 && !now.Before(q[0].expire) {
+			g.remove(q[0])
+			q[0] = nil
+			q = q[1:]
+		}
+		g.completed[i] = q
+	}
+	c, ok := g.m[key]
+	return c, ok
+}
+
+// remove 把c从m中删除，Forget之后key可能已经对应新的调用
+func (g *Ones) remove(c *call) {
+	if g.m[c.key] == c {
+		delete(g.m, c.key)
 	}
-	c := new(call)
-	g.m[key] = c        //添加到g.m表示key已经有请求在处理
-	c.val, c.err = fn() //调用fn，发起请求
-	N++
-	go func() {
-		time.Sleep(time.Second)
-		delete(g.m, key) //更新g.m
+}
+
+// Do 同一个key同时只有一个fn在执行，其他调用方等待并共享它的结果；
+// 不同的key并行执行。fn返回之后的复用窗口内，同一个key直接返回这次的结果。
+func (g *Ones) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	v, err, _ := g.DoShared(key, fn)
+	return v, err
+}
+
+// DoShared 和Do一样，shared表示结果是否同时返回给了多个调用方
+func (g *Ones) DoShared(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if c, ok := g.lookup(key); ok {
+		//请求正在进行或者还在复用窗口内，等待并返回它的结果
+		c.dups++
+		g.mu.Unlock()
+		c.wg.Wait()
+		if e, ok := c.err.(*PanicError); ok {
+			panic(e)
+		} else if c.err == ErrGoexit {
+			runtime.Goexit()
+		}
+		return c.val, c.err, true
+	}
+	c := &call{key: key}
+	c.wg.Add(1)
+	g.m[key] = c //添加到g.m表示key已经有请求在处理
+	g.mu.Unlock()
+
+	shared = g.doCall(c, fn)
+	if e, ok := c.err.(*PanicError); ok {
+		panic(e)
+	}
+	return c.val, c.err, shared
+}
+
+// DoChan 和Do一样，但不阻塞，结果在fn返回之后发送到返回的channel
+func (g *Ones) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	if c, ok := g.lookup(key); ok {
+		c.dups++
+		if c.done {
+			ch <- Result{Val: c.val, Err: c.err, Shared: true}
+		} else {
+			c.chans = append(c.chans, ch)
+		}
+		g.mu.Unlock()
+		return ch
+	}
+	c := &call{key: key, chans: []chan<- Result{ch}}
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	go g.doCall(c, fn)
+	return ch
+}
+
+// doCall 调用fn，把结果通知所有等待的调用方，并按结果的复用窗口记录过期时间；返回结果是否被共享。
+// fn panic时c.err为*PanicError，调用了runtime.Goexit时c.err为ErrGoexit，这两种情况都不复用结果。
+func (g *Ones) doCall(c *call, fn func() (interface{}, error)) (shared bool) {
+	protect(func() {
+		c.val, c.err = fn() //调用fn，发起请求
+	}, func(err error) {
+		if err != nil {
+			c.val, c.err = nil, err
+		}
+		shared = g.finish(c)
+	})
+	return
+}
+
+// protect 调用fn，之后调用done：fn panic时err为*PanicError，调用了runtime.Goexit时err为ErrGoexit，否则为nil。
+// 即使fn调用了runtime.Goexit，done也会执行，保证等待的调用方被唤醒、key被删除。
+func protect(fn func(), done func(err error)) {
+	normalReturn := false
+	recovered := false
+	var err error
+	defer func() {
+		if !normalReturn && !recovered {
+			err = ErrGoexit
+		}
+		done(err)
 	}()
 
-	return c.val, c.err //返回结果
+	func() {
+		defer func() {
+			if !normalReturn {
+				if r := recover(); r != nil {
+					err = newPanicError(r)
+				}
+			}
+		}()
+		fn()
+		normalReturn = true
+	}()
+	if !normalReturn {
+		recovered = true
+	}
+}
+
+// finish 把c的结果通知所有等待的调用方，并按结果的复用窗口记录过期时间
+func (g *Ones) finish(c *call) (shared bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.done = true
+	c.wg.Done()
+	shared = c.dups > 0
+	for _, ch := range c.chans {
+		ch <- Result{Val: c.val, Err: c.err, Shared: shared}
+	}
+	c.chans = nil
+
+	window := g.window(c.err)
+	if _, ok := c.err.(*PanicError); ok || c.err == ErrGoexit || window <= 0 {
+		g.remove(c)
+		return shared
+	}
+	c.expire = time.Now().Add(window)
+	i := 0
+	if c.err != nil {
+		i = 1
+	}
+	g.completed[i] = append(g.completed[i], c)
+	return shared
+}
+
+// Forget 让之后的调用不再等待或者复用key当前的调用，而是重新执行fn
+func (g *Ones) Forget(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.m, key)
 }
@@ -1,21 +1,24 @@
 package singleflight
 
 import (
+	"errors"
 	"fmt"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
-var ExecTimes = 0
+var ExecTimes int64
 
 func TestDoCase1(t *testing.T) {
-	ExecTimes = 0
+	atomic.StoreInt64(&ExecTimes, 0)
 	var g Ones
 	wg := sync.WaitGroup{}
 	wg.Add(10000)
 	fn := func() (interface{}, error) {
-		ExecTimes++
+		atomic.AddInt64(&ExecTimes, 1)
 		return "", nil
 	}
 	for i := 0; i < 10000; i++ {
@@ -25,14 +28,14 @@ func TestDoCase1(t *testing.T) {
 		}()
 	}
 	wg.Wait()
-	fmt.Println(ExecTimes)
-	if ExecTimes != 1 {
+	fmt.Println(atomic.LoadInt64(&ExecTimes))
+	if atomic.LoadInt64(&ExecTimes) != 1 {
 		t.Error("singleFlight err")
 	}
 }
 
 func TestDoCase2(t *testing.T) {
-	ExecTimes = 0
+	atomic.StoreInt64(&ExecTimes, 0)
 	var g Ones
 	wg := sync.WaitGroup{}
 	wg.Add(100)
@@ -40,7 +43,7 @@ func TestDoCase2(t *testing.T) {
 		go func() {
 			defer wg.Done()
 			i, _ := g.Do("key", func() (interface{}, error) {
-				ExecTimes++
+				atomic.AddInt64(&ExecTimes, 1)
 				return "bar", nil
 			})
 			v := i.(string)
@@ -49,7 +52,7 @@ func TestDoCase2(t *testing.T) {
 			}
 
 			i, _ = g.Do("key1", func() (interface{}, error) {
-				ExecTimes++
+				atomic.AddInt64(&ExecTimes, 1)
 				return "bar", nil
 			})
 			v = i.(string)
@@ -59,14 +62,14 @@ func TestDoCase2(t *testing.T) {
 		}()
 	}
 	wg.Wait()
-	fmt.Println(ExecTimes)
-	if ExecTimes != 2 {
+	fmt.Println(atomic.LoadInt64(&ExecTimes))
+	if atomic.LoadInt64(&ExecTimes) != 2 {
 		t.Error("singleFlight err")
 	}
 }
 
 func TestDoCase3(t *testing.T) {
-	ExecTimes = 0
+	atomic.StoreInt64(&ExecTimes, 0)
 	var g Ones
 	wg := sync.WaitGroup{}
 	wg.Add(100)
@@ -74,7 +77,7 @@ func TestDoCase3(t *testing.T) {
 		go func() {
 			defer wg.Done()
 			i, _ := g.Do("key", func() (interface{}, error) {
-				ExecTimes++
+				atomic.AddInt64(&ExecTimes, 1)
 				return "bar", nil
 			})
 			v := i.(string)
@@ -89,7 +92,7 @@ func TestDoCase3(t *testing.T) {
 		go func() {
 			defer wg.Done()
 			i, _ := g.Do("key", func() (interface{}, error) {
-				ExecTimes++
+				atomic.AddInt64(&ExecTimes, 1)
 				return "bar", nil
 			})
 			v := i.(string)
@@ -99,8 +102,223 @@ func TestDoCase3(t *testing.T) {
 		}()
 	}
 	wg.Wait()
-	fmt.Println(ExecTimes)
-	if ExecTimes != 2 {
+	fmt.Println(atomic.LoadInt64(&ExecTimes))
+	if atomic.LoadInt64(&ExecTimes) != 2 {
 		t.Error("singleFlight err")
 	}
 }
+
+func TestDoParallelKeys(t *testing.T) {
+	var g Ones
+	//不同的 key 并行执行，fn 执行时不持有锁
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			g.Do(fmt.Sprintf("key%d", i), func() (interface{}, error) {
+				time.Sleep(100 * time.Millisecond)
+				return nil, nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("不同的 key 应该并行执行, 用时 %v", d)
+	}
+}
+
+func TestDoShared(t *testing.T) {
+	var g Ones
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		g.DoShared("key", func() (interface{}, error) {
+			close(started)
+			<-release
+			return "bar", nil
+		})
+	}()
+	<-started
+	ch := g.DoChan("key", func() (interface{}, error) {
+		t.Error("正在进行的调用不应该再次执行")
+		return nil, nil
+	})
+	done := make(chan Result)
+	go func() {
+		v, err, shared := g.DoShared("key", func() (interface{}, error) {
+			t.Error("正在进行的调用不应该再次执行")
+			return nil, nil
+		})
+		done <- Result{v, err, shared}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for _, r := range []Result{<-ch, <-done} {
+		if r.Val != "bar" || r.Err != nil || !r.Shared {
+			t.Errorf("result = %+v, 预期共享 bar", r)
+		}
+	}
+	//复用窗口内的结果也是共享的
+	if r := <-g.DoChan("key", nil); r.Val != "bar" || !r.Shared {
+		t.Errorf("result = %+v", r)
+	}
+	if _, _, shared := new(Ones).DoShared("key", func() (interface{}, error) { return nil, nil }); shared {
+		t.Error("只有一个调用方时 shared 应该为 false")
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Ones
+	calls := 0
+	fn := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+	g.Do("key", fn)
+	g.Do("key", fn)
+	if calls != 1 {
+		t.Fatalf("复用窗口内不应该再次执行, calls = %d", calls)
+	}
+	g.Forget("key")
+	if v, _ := g.Do("key", fn); v != 2 {
+		t.Errorf("Forget 之后应该重新执行, v = %v", v)
+	}
+}
+
+func TestReuseWindow(t *testing.T) {
+	g := Ones{SuccessWindow: 50 * time.Millisecond, ErrorWindow: 20 * time.Millisecond}
+	var calls int64
+	ok := func() (interface{}, error) {
+		return atomic.AddInt64(&calls, 1), nil
+	}
+	fail := func() (interface{}, error) {
+		atomic.AddInt64(&calls, 1)
+		return nil, errors.New("fail")
+	}
+
+	g.Do("ok", ok)
+	g.Do("fail", fail)
+	if v, _ := g.Do("ok", ok); v != int64(1) {
+		t.Errorf("窗口内应该复用成功的结果, v = %v", v)
+	}
+	if _, err := g.Do("fail", fail); err == nil || atomic.LoadInt64(&calls) != 2 {
+		t.Error("窗口内应该复用错误")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if g.Do("fail", fail); atomic.LoadInt64(&calls) != 3 {
+		t.Error("超过 ErrorWindow 应该重新执行")
+	}
+	if v, _ := g.Do("ok", ok); v != int64(1) {
+		t.Error("SuccessWindow 内应该复用成功的结果")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if v, _ := g.Do("ok", ok); v != int64(4) {
+		t.Errorf("超过 SuccessWindow 应该重新执行, v = %v", v)
+	}
+
+	//过期的调用在之后访问任何 key 时被删除
+	time.Sleep(60 * time.Millisecond)
+	g.Do("other", ok)
+	g.mu.Lock()
+	n := len(g.m)
+	g.mu.Unlock()
+	if n != 1 {
+		t.Errorf("过期的调用应该被删除, len(m) = %d", n)
+	}
+}
+
+func TestNoReuse(t *testing.T) {
+	g := Ones{SuccessWindow: -1}
+	var calls int64
+	fn := func() (interface{}, error) {
+		return atomic.AddInt64(&calls, 1), nil
+	}
+	g.Do("key", fn)
+	g.Do("key", fn)
+	if _, err := g.Do("key", func() (interface{}, error) { return nil, errors.New("fail") }); err == nil {
+		t.Error("err 不应该为 nil")
+	}
+	g.Do("key", fn)
+	if atomic.LoadInt64(&calls) != 3 {
+		t.Errorf("不复用时每次都应该执行, calls = %d", calls)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	var g Ones
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fn := func() (interface{}, error) {
+		close(started)
+		<-release
+		panic("boom")
+	}
+	recovered := make(chan interface{}, 2)
+	do := func(fn func() (interface{}, error)) {
+		defer func() { recovered <- recover() }()
+		g.Do("key", fn)
+	}
+	go do(fn)
+	<-started
+	go do(func() (interface{}, error) {
+		t.Error("正在进行的调用不应该再次执行")
+		return nil, nil
+	})
+	ch := g.DoChan("key", nil)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	//所有等待的调用方都以 *PanicError 再次 panic
+	for i := 0; i < 2; i++ {
+		e, ok := (<-recovered).(*PanicError)
+		if !ok || e.Value != "boom" || len(e.Stack) == 0 {
+			t.Errorf("recover() = %v, 预期 *PanicError", e)
+		}
+	}
+	var e *PanicError
+	if r := <-ch; !errors.As(r.Err, &e) || e.Value != "boom" {
+		t.Errorf("DoChan result = %+v, 预期 *PanicError", r)
+	}
+	//key 被删除，结果不复用
+	if v, err := g.Do("key", func() (interface{}, error) { return "bar", nil }); v != "bar" || err != nil {
+		t.Errorf("panic 之后应该重新执行, v = %v, err = %v", v, err)
+	}
+}
+
+func TestGoexit(t *testing.T) {
+	var g Ones
+	release := make(chan struct{})
+	started := make(chan struct{})
+	exited := make(chan bool, 2)
+	do := func(fn func() (interface{}, error)) {
+		normalReturn := false
+		defer func() { exited <- !normalReturn }()
+		g.Do("key", fn)
+		normalReturn = true
+	}
+	go do(func() (interface{}, error) {
+		close(started)
+		<-release
+		runtime.Goexit()
+		return nil, nil
+	})
+	<-started
+	go do(nil)
+	ch := g.DoChan("key", nil)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		if !<-exited {
+			t.Error("等待的调用方应该调用 runtime.Goexit")
+		}
+	}
+	if r := <-ch; r.Err != ErrGoexit {
+		t.Errorf("DoChan result = %+v, 预期 ErrGoexit", r)
+	}
+	if v, _ := g.Do("key", func() (interface{}, error) { return "bar", nil }); v != "bar" {
+		t.Errorf("Goexit 之后应该重新执行, v = %v", v)
+	}
+}
@@ -0,0 +1,172 @@
+package gcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gcache/lru"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 快照文件格式(整数都是小端序)：
+//
+//	header:  magic "GCSN" | version uint16 | 快照时间 int64(unix纳秒)
+//	entry:   key | value | list | 剩余ttl int64(纳秒，0表示永不过期)，key、value、list都是 uvarint长度+内容
+//	trailer: entry个数 uint32 | 前面所有内容的crc32(IEEE) uint32
+const (
+	snapshotMagic   = "GCSN"
+	snapshotVersion = 1
+	headerSize      = len(snapshotMagic) + 2 + 8
+	trailerSize     = 4 + 4
+)
+
+// ErrBadSnapshot 快照文件不完整、校验失败或者版本不支持
+var ErrBadSnapshot = errors.New("gcache: bad snapshot")
+
+// SaveSnapshot 把本地缓存中所有未过期的缓存项(key、value、所在的链表、剩余的ttl)写入w
+func (c *GCache) SaveSnapshot(w io.Writer) error {
+	entries := c.MainCache.snapshot()
+	now := time.Now()
+
+	buf := bytes.NewBuffer(make([]byte, 0, headerSize))
+	buf.WriteString(snapshotMagic)
+	binary.Write(buf, binary.LittleEndian, uint16(snapshotVersion))
+	binary.Write(buf, binary.LittleEndian, now.UnixNano())
+
+	var n uint32
+	for _, e := range entries {
+		var ttl int64
+		if !e.Expire.IsZero() {
+			if ttl = int64(e.Expire.Sub(now)); ttl <= 0 {
+				continue
+			}
+		}
+		writeBytes(buf, []byte(e.Key))
+		writeBytes(buf, e.Value.(ByteView).b)
+		writeBytes(buf, []byte(e.List))
+		binary.Write(buf, binary.LittleEndian, ttl)
+		n++
+	}
+
+	binary.Write(buf, binary.LittleEndian, n)
+	binary.Write(buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()))
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// LoadSnapshot 从r读取SaveSnapshot写入的快照并加入本地缓存。
+// 快照不完整或者校验失败时返回ErrBadSnapshot，不会加载任何缓存项。
+func (c *GCache) LoadSnapshot(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	entries, err := decodeSnapshot(data, time.Now())
+	if err != nil {
+		return err
+	}
+	c.MainCache.restore(entries)
+	return nil
+}
+
+// SaveSnapshotFile 把快照写入path，先写临时文件再重命名，写入过程中崩溃不会留下不完整的快照
+func (c *GCache) SaveSnapshotFile(path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err = c.SaveSnapshot(f); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadSnapshotFile 从path加载快照
+func (c *GCache) LoadSnapshotFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.LoadSnapshot(f)
+}
+
+// decodeSnapshot 校验并解析快照，剩余ttl从now开始计算
+func decodeSnapshot(data []byte, now time.Time) ([]lru.Entry, error) {
+	if len(data) < headerSize+trailerSize {
+		return nil, fmt.Errorf("%w: too short", ErrBadSnapshot)
+	}
+	body, trailer := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(trailer) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrBadSnapshot)
+	}
+	if string(body[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrBadSnapshot)
+	}
+	if v := binary.LittleEndian.Uint16(body[len(snapshotMagic):]); v != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrBadSnapshot, v)
+	}
+	count := binary.LittleEndian.Uint32(body[len(body)-4:])
+
+	r := bytes.NewReader(body[headerSize : len(body)-4])
+	entries := make([]lru.Entry, 0, count)
+	for r.Len() > 0 {
+		key, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		list, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		var ttl int64
+		if err := binary.Read(r, binary.LittleEndian, &ttl); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+		}
+		e := lru.Entry{Key: string(key), Value: ByteView{b: value}, List: string(list)}
+		if ttl > 0 {
+			e.Expire = now.Add(time.Duration(ttl))
+		}
+		entries = append(entries, e)
+	}
+	if uint32(len(entries)) != count {
+		return nil, fmt.Errorf("%w: expect %d entries, got %d", ErrBadSnapshot, count, len(entries))
+	}
+	return entries, nil
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	var n [binary.MaxVarintLen64]byte
+	buf.Write(n[:binary.PutUvarint(n[:], uint64(len(b)))])
+	buf.Write(b)
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+	}
+	if n > uint64(r.Len()) {
+		return nil, fmt.Errorf("%w: length %d out of range", ErrBadSnapshot, n)
+	}
+	b := make([]byte, n)
+	r.Read(b)
+	return b, nil
+}
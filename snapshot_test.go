@@ -0,0 +1,111 @@
+package gcache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gcache/lru"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newSnapshotCache(opts Options) *GCache {
+	return NewCacheWithOptions(64<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s not exist", key)
+	}), opts)
+}
+
+func TestSnapshot(t *testing.T) {
+	src := newSnapshotCache(Options{Shards: 4})
+	src.populateCache("a", ByteView{b: []byte("aa")}, 0)
+	src.populateCache("b", ByteView{b: []byte("bb")}, time.Hour)
+	src.populateCache("c", ByteView{b: []byte("cc")}, 50*time.Millisecond)
+	//a 放到 old list
+	src.MainCache.restore([]lru.Entry{{Key: "a", Value: ByteView{b: []byte("aa")}, List: "old"}})
+
+	var buf bytes.Buffer
+	if err := src.SaveSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	//分片个数不同也可以加载
+	dst := newSnapshotCache(Options{Shards: 2})
+	if err := dst.LoadSnapshot(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"a": "aa", "b": "bb", "c": "cc"} {
+		if v, ok := dst.MainCache.get(key); !ok || v.String() != want {
+			t.Errorf("加载的 %s 不是预期的", key)
+		}
+	}
+	//c 只保留了剩余的 ttl
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := dst.MainCache.get("c"); ok {
+		t.Error("c 应该已经过期")
+	}
+	if s := dst.Stats(); s.Lists[1].Name != "old" || s.Lists[1].Items != 1 {
+		t.Errorf("a 应该加载到 old list, lists = %v", s.Lists)
+	}
+}
+
+func TestSnapshotCorrupted(t *testing.T) {
+	src := newSnapshotCache(Options{})
+	for i := 0; i < 10; i++ {
+		src.populateCache(fmt.Sprintf("key%d", i), ByteView{b: []byte("value")}, 0)
+	}
+	var buf bytes.Buffer
+	src.SaveSnapshot(&buf)
+	data := buf.Bytes()
+
+	truncated := data[:len(data)-10]
+	flipped := append([]byte(nil), data...)
+	flipped[headerSize+1] ^= 0xff
+	for name, b := range map[string][]byte{"truncated": truncated, "flipped": flipped, "empty": nil} {
+		dst := newSnapshotCache(Options{})
+		if err := dst.LoadSnapshot(bytes.NewReader(b)); !errors.Is(err, ErrBadSnapshot) {
+			t.Errorf("%s: err = %v, 预期 ErrBadSnapshot", name, err)
+		}
+		if s := dst.Stats(); s.Items != 0 {
+			t.Errorf("%s: 不应该加载任何 kv, 实际加载了 %d 个", name, s.Items)
+		}
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gcache.snapshot")
+	src := newSnapshotCache(Options{Policy: ARCPolicy})
+	src.populateCache("a", ByteView{b: []byte("aa")}, 0)
+	if err := src.SaveSnapshotFile(path); err != nil {
+		t.Fatal(err)
+	}
+	dst := newSnapshotCache(Options{Policy: ARCPolicy})
+	if err := dst.LoadSnapshotFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := dst.Get("a"); err != nil || v.String() != "aa" {
+		t.Errorf("获得的 kv 不是预期的: %v %v", v, err)
+	}
+}
+
+func TestSnapshotArena(t *testing.T) {
+	src := newSnapshotCache(Options{Policy: ArenaPolicy, Shards: 2})
+	src.populateCache("a", ByteView{b: []byte("aa")}, 0)
+	src.populateCache("b", ByteView{b: []byte("bb")}, time.Hour)
+	var buf bytes.Buffer
+	if err := src.SaveSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	//arena 的快照也可以加载到其他淘汰策略
+	dst := newSnapshotCache(Options{})
+	if err := dst.LoadSnapshot(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"a": "aa", "b": "bb"} {
+		if v, err := dst.Get(key); err != nil || v.String() != want {
+			t.Errorf("加载的 %s 不是预期的: %v %v", key, v, err)
+		}
+	}
+	if s := src.Stats(); s.Items != 2 || s.Lists[0].Name != "arena" {
+		t.Errorf("stats = %+v", s)
+	}
+}
@@ -0,0 +1,106 @@
+package gcache
+
+import (
+	"gcache/lru"
+	"strconv"
+	"sync/atomic"
+)
+
+// atomicInt 可以并发读写的int64计数器
+type atomicInt int64
+
+// Add 原子地加上n
+func (i *atomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// Get 原子地读取值
+func (i *atomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *atomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+// cacheStats GCache的计数器，用原子操作更新，读取时不需要加锁
+type cacheStats struct {
+	gets          atomicInt
+	hits          atomicInt
+	misses        atomicInt
+	peerLoads     atomicInt
+	peerErrors    atomicInt
+	localLoads    atomicInt
+	localLoadErrs atomicInt
+	dedupLoads    atomicInt
+	negativeHits  atomicInt
+	hotHits       atomicInt
+}
+
+// Stats GCache统计信息的快照
+type Stats struct {
+	Gets          int64 // Get的调用次数
+	Hits          int64 // 本地缓存命中次数
+	Misses        int64 // 本地缓存没有命中的次数
+	PeerLoads     int64 // 从远端peer加载成功的次数
+	PeerErrors    int64 // 从远端peer加载失败的次数，不包括peer返回的不存在
+	LocalLoads    int64 // 通过Getter加载成功的次数
+	LocalLoadErrs int64 // 通过Getter加载失败的次数
+	DedupLoads    int64 // 被singleflight合并，没有真正发起加载的次数
+	NegativeHits  int64 // 负缓存命中，直接返回ErrNotFound的次数
+	HotHits       int64 // 热点缓存命中的次数，包含在Hits中
+	HotBytes      int64 // 热点缓存已经使用的容量
+	HotItems      int64 // 热点缓存k-v的个数
+	Evictions     int64 // 因为容量不足被淘汰的缓存项个数
+	Expirations   int64 // 因为过期被删除的缓存项个数
+	Promotions    int64 // 晋升到热点链表的次数，如young晋升到old
+	Bytes         int64 // 本地缓存已经使用的容量
+	Items         int64 // 本地缓存k-v的个数
+	//Lists 每个链表的统计信息，分片时为所有分片中同名链表之和
+	Lists []lru.ListStats
+}
+
+// Stats 返回统计信息的快照
+func (c *GCache) Stats() Stats {
+	s := Stats{
+		Gets:          c.stats.gets.Get(),
+		Hits:          c.stats.hits.Get(),
+		Misses:        c.stats.misses.Get(),
+		PeerLoads:     c.stats.peerLoads.Get(),
+		PeerErrors:    c.stats.peerErrors.Get(),
+		LocalLoads:    c.stats.localLoads.Get(),
+		LocalLoadErrs: c.stats.localLoadErrs.Get(),
+		DedupLoads:    c.stats.dedupLoads.Get(),
+		NegativeHits:  c.stats.negativeHits.Get(),
+		HotHits:       c.stats.hotHits.Get(),
+	}
+	c.MainCache.addStats(&s)
+	if c.hotCache != nil {
+		hs := c.hotCache.policyStats()
+		s.HotBytes, s.HotItems = hs.Bytes, hs.Items
+	}
+	return s
+}
+
+// addStats 把分片的统计信息累加到s
+func (s *shardedCache) addStats(stats *Stats) {
+	index := map[string]int{}
+	for _, c := range s.shards {
+		stats.Evictions += c.evictions.Get()
+		stats.Expirations += c.expirations.Get()
+		ps := c.policyStats()
+		stats.Promotions += ps.Promotions
+		stats.Bytes += ps.Bytes
+		stats.Items += ps.Items
+		for _, l := range ps.Lists {
+			i, ok := index[l.Name]
+			if !ok {
+				i = len(stats.Lists)
+				index[l.Name] = i
+				stats.Lists = append(stats.Lists, lru.ListStats{Name: l.Name})
+			}
+			stats.Lists[i].Bytes += l.Bytes
+			stats.Lists[i].Items += l.Items
+		}
+	}
+}
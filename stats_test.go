@@ -0,0 +1,63 @@
+package gcache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	db := map[string]string{"a": "aa", "b": "bb", "c": "cc"}
+	c := NewCacheWithOptions(1<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s not exist", key)
+	}), Options{Shards: 2})
+
+	c.Get("a")
+	c.Get("a")
+	c.Get("b")
+	c.Get("x")
+	s := c.Stats()
+	if s.Gets != 4 || s.Hits != 1 || s.Misses != 3 {
+		t.Errorf("gets/hits/misses = %d/%d/%d, 预期 4/1/3", s.Gets, s.Hits, s.Misses)
+	}
+	if s.LocalLoads != 2 || s.LocalLoadErrs != 1 || s.PeerLoads != 0 {
+		t.Errorf("localLoads/localLoadErrs/peerLoads = %d/%d/%d, 预期 2/1/0", s.LocalLoads, s.LocalLoadErrs, s.PeerLoads)
+	}
+	//Bytes 包含每个 kv 的额外开销
+	if s.Items != 2 || s.Bytes <= 6 || s.Bytes != s.Lists[0].Bytes+s.Lists[1].Bytes {
+		t.Errorf("items/bytes = %d/%d, 不是预期的", s.Items, s.Bytes)
+	}
+	if len(s.Lists) != 2 || s.Lists[0].Name != "young" || s.Lists[0].Items != 2 {
+		t.Errorf("lists = %v, 不是预期的", s.Lists)
+	}
+
+	//Delete 之后重新加载，不复用 singleflight 窗口内的结果
+	c.Delete("b")
+	c.Get("b")
+	if s := c.Stats(); s.DedupLoads != 0 || s.LocalLoads != 3 {
+		t.Errorf("dedupLoads/localLoads = %d/%d, 预期 0/3", s.DedupLoads, s.LocalLoads)
+	}
+
+	time.Sleep(time.Second + 100*time.Millisecond)
+	c.Get("a")
+	if s := c.Stats(); s.Promotions != 1 || s.Lists[1].Name != "old" || s.Lists[1].Items != 1 {
+		t.Errorf("promotions = %d, lists = %v, 不是预期的", s.Promotions, s.Lists)
+	}
+}
+
+func TestStatsEvictions(t *testing.T) {
+	c := NewCacheWithOptions(40, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}), Options{Policy: LFUPolicy, DefaultTTL: time.Hour})
+	//每个 kv 占 9 字节，最多缓存 4 个
+	for i := 0; i < 6; i++ {
+		c.Get(fmt.Sprintf("key%d", i))
+	}
+	if s := c.Stats(); s.Evictions != 2 || s.Items != 4 {
+		t.Errorf("evictions/items = %d/%d, 预期 2/4", s.Evictions, s.Items)
+	}
+	c.Close()
+}
@@ -0,0 +1,174 @@
+package tinylfu
+
+const (
+	// sketch 的行数，每个key在每一行各有一个计数器，估算时取最小值
+	depth = 4
+	// 计数器的最大值，和4bit计数器一样
+	maxCount = 15
+	// 记录了 samples 次访问之后进行一次衰减
+	sampleFactor = 10
+)
+
+// Filter W-TinyLFU准入过滤器，并发访问是不安全的。
+// 由count-min sketch估算key最近的访问频率，doorkeeper布隆过滤器挡住只访问过一次的key，
+// 每记录 sampleFactor*counters 次访问后把所有计数器减半并清空doorkeeper，让旧的访问频率逐渐失效。
+type Filter struct {
+	sketch cmSketch
+	door   bloom
+	//距离上次衰减记录的访问次数
+	additions int
+	samples   int
+}
+
+// New 创建一个准入过滤器，counters为每一行计数器的个数(向上取2的幂)，建议为缓存key个数的数倍。
+func New(counters int) *Filter {
+	width := nextPowerOfTwo(counters)
+	return &Filter{
+		sketch:  newCMSketch(width),
+		door:    newBloom(width),
+		samples: sampleFactor * width,
+	}
+}
+
+// Record 记录一次key的访问
+func (f *Filter) Record(key string) {
+	h := hash(key)
+	//第一次访问只记录在doorkeeper中
+	if f.door.addIfAbsent(h) {
+		f.sketch.increment(h)
+	}
+	f.additions++
+	if f.additions >= f.samples {
+		f.reset()
+	}
+}
+
+// Estimate 估算key最近的访问次数
+func (f *Filter) Estimate(key string) int {
+	h := hash(key)
+	n := f.sketch.estimate(h)
+	if f.door.contains(h) {
+		n++
+	}
+	return n
+}
+
+// Admit 判断candidate是否可以替换掉将被淘汰的victim：只有candidate的访问频率更高时才准入
+func (f *Filter) Admit(candidate, victim string) bool {
+	return f.Estimate(candidate) > f.Estimate(victim)
+}
+
+// reset 衰减：所有计数器减半，清空doorkeeper
+func (f *Filter) reset() {
+	f.sketch.halve()
+	f.door.clear()
+	f.additions /= 2
+}
+
+// cmSketch count-min sketch，depth 行计数器，每行width个
+type cmSketch struct {
+	rows [depth][]uint8
+	mask uint32
+}
+
+func newCMSketch(width int) cmSketch {
+	var s cmSketch
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	s.mask = uint32(width - 1)
+	return s
+}
+
+// index 由h的高低32位做double hashing，得到key在第i行的下标
+func (s *cmSketch) index(h uint64, i int) uint32 {
+	h1, h2 := uint32(h), uint32(h>>32)
+	return (h1 + uint32(i)*h2) & s.mask
+}
+
+func (s *cmSketch) increment(h uint64) {
+	for i := range s.rows {
+		if idx := s.index(h, i); s.rows[i][idx] < maxCount {
+			s.rows[i][idx]++
+		}
+	}
+}
+
+func (s *cmSketch) estimate(h uint64) int {
+	min := uint8(maxCount)
+	for i := range s.rows {
+		if v := s.rows[i][s.index(h, i)]; v < min {
+			min = v
+		}
+	}
+	return int(min)
+}
+
+func (s *cmSketch) halve() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+}
+
+// bloom doorkeeper使用的布隆过滤器，每个key占2个bit
+type bloom struct {
+	bits []uint64
+	mask uint32
+}
+
+func newBloom(width int) bloom {
+	//每个计数器对应8个bit
+	n := width * 8
+	return bloom{bits: make([]uint64, (n+63)/64), mask: uint32(n - 1)}
+}
+
+func (b *bloom) locations(h uint64) [2]uint32 {
+	h1, h2 := uint32(h), uint32(h>>32)
+	return [2]uint32{h1 & b.mask, (h1 + h2) & b.mask}
+}
+
+func (b *bloom) contains(h uint64) bool {
+	for _, loc := range b.locations(h) {
+		if b.bits[loc/64]&(1<<(loc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// addIfAbsent 把h加入布隆过滤器，返回h之前是否已经存在
+func (b *bloom) addIfAbsent(h uint64) bool {
+	if b.contains(h) {
+		return true
+	}
+	for _, loc := range b.locations(h) {
+		b.bits[loc/64] |= 1 << (loc % 64)
+	}
+	return false
+}
+
+func (b *bloom) clear() {
+	for i := range b.bits {
+		b.bits[i] = 0
+	}
+}
+
+// hash FNV-1a 64，不需要像hash/fnv那样分配内存
+func hash(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+func nextPowerOfTwo(n int) int {
+	p := 16
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
@@ -0,0 +1,75 @@
+package tinylfu
+
+import (
+	"hash/fnv"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	for _, key := range []string{"", "hello", "hell0"} {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		if hash(key) != h.Sum64() {
+			t.Errorf("hash(%q) 和 fnv64a 不一致", key)
+		}
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	f := New(64)
+	if f.Estimate("hello") != 0 {
+		t.Error("没有访问过的 key 估算值应该为 0")
+	}
+	f.Record("hello")
+	if f.Estimate("hello") != 1 || f.sketch.estimate(hash("hello")) != 0 {
+		t.Error("第一次访问应该只记录在 doorkeeper")
+	}
+	for i := 0; i < 4; i++ {
+		f.Record("hello")
+	}
+	if n := f.Estimate("hello"); n != 5 {
+		t.Errorf("Estimate = %d, 预期 5", n)
+	}
+	for i := 0; i < 20; i++ {
+		f.Record("hello")
+	}
+	if n := f.Estimate("hello"); n != maxCount+1 {
+		t.Errorf("Estimate = %d, 计数器应该在 %d 饱和", n, maxCount)
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	f := New(64)
+	for i := 0; i < 5; i++ {
+		f.Record("hot")
+	}
+	f.Record("cold")
+	if f.Admit("cold", "hot") {
+		t.Error("访问频率低的 key 不应该替换访问频率高的 key")
+	}
+	if !f.Admit("hot", "cold") {
+		t.Error("访问频率高的 key 应该替换访问频率低的 key")
+	}
+	if f.Admit("new", "cold") {
+		t.Error("访问频率相同时不应该准入")
+	}
+}
+
+func TestReset(t *testing.T) {
+	f := New(1024)
+	for i := 0; i < 9; i++ {
+		f.Record("hello")
+	}
+	//再记录一次访问就达到 samples 次，触发衰减
+	f.additions = f.samples - 1
+	f.Record("world")
+	if f.additions != f.samples/2 {
+		t.Errorf("additions = %d, 预期衰减为 %d", f.additions, f.samples/2)
+	}
+	if n := f.sketch.estimate(hash("hello")); n != 4 {
+		t.Errorf("衰减之后计数器应该减半为 4, 实际为 %d", n)
+	}
+	if f.door.contains(hash("hello")) {
+		t.Error("衰减之后应该清空 doorkeeper")
+	}
+}